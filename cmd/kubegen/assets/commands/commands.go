@@ -28,6 +28,35 @@ func init() {
 		{"bundle", "--output=json", "--stdout", ".examples/sockshop.yml"},
 		{"bundle", "--output=json", "--stdout", ".examples/weavecloud.yml"},
 		{"bundle", "--output=json", "--stdout", ".examples/weavecloud.yml", ".examples/sockshop.yml"},
+		{"module", "--mask-sensitive", "-s", ".examples/modules/weavecloud", "-p", "service_token=e"},
+		{"module", "--mask-sensitive", "--output=json", "-s", ".examples/modules/weavecloud", "-p", "service_token=e"},
+		{"module", "-s", ".examples/modules/sockshop", "-p", "image_registry=registry.example.com:5000/sockshop"},
+		{"module", "describe", ".examples/modules/sockshop"},
+		{"module", "describe", "--format=json", ".examples/modules/weavecloud"},
+		{"module", "describe", "--format=markdown", ".examples/modules/weavecloud"},
+		{"module", "-s", "-f", ".examples/sockshop-values.yml", ".examples/modules/sockshop"},
+		{"module", "-s", "-f", ".examples/sockshop-values.yml", "-p", "image_registry=gcr.io/sockshop", ".examples/modules/sockshop"},
+		{"module", "-s", "-f", ".examples/weavecloud-values.hcl", ".examples/modules/weavecloud"},
+		{"module", "-s", ".examples/modules/weavecloud", "-p", "service_token=\"1234\""},
+		{"bundle", "--explain", ".examples/sockshop.yml"},
+		{"bundle", "--explain", ".examples/weavecloud.yml", ".examples/sockshop-staging.yml"},
+		{"bundle", "--print-effective-bundle", ".examples/sockshop-staging.yml"},
+		{"bundle", "--print-effective-bundle", "--output=json", ".examples/sockshop-staging.yml"},
+		{"bundle", "--stdout", ".examples/sockshop-staging.yml"},
+		{"module", "-s", ".examples/modules/sockshop-monitored", "-p", "service_token=abc123"},
+		{"module", "-s", ".examples/modules/sockshop-monitored", "-p", "service_token=abc123", "-p", "image_registry=gcr.io/sockshop"},
+		{"bundle", "--explain", ".examples/sockshop-monitored.yml"},
+		{"bundle", "--stdout", "--frozen", ".examples/weavecloud.yml", ".examples/sockshop-staging.yml"},
+		{"module", "-s", ".examples/modules/sockshop", "-p", "mongo_image=mongo:3.4"},
+		{"module", "-s", ".examples/modules/weavecloud", "-p", "service_token=abc123", "--name-prefix=test-"},
+		{"module", "-s", ".examples/modules/sockshop", "--name-suffix=-1"},
+		{"module", "-s", ".examples/modules/sockshop", "-p", "image_regsitry=gcr.io/sockshop", "--allow-undeclared-parameters"},
+		{"migrate", "--dry-run", ".examples"},
+		{"test", ".examples/modules/weavecloud"},
+		{"bundle", "--help"},
+		{"module", "-s", ".examples/modules/weavecloud", "-p", "service_token=abc123", "--provenance-annotations"},
+		{"module", "-s", ".examples/modules/sockshop", "--yaml-style=stream"},
+		{"bundle", "--stdout", "--output=json", "--json-style=ndjson", ".examples/sockshop-staging.yml"},
 	}
 
 	for _, command := range commands {
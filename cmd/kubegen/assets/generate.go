@@ -12,7 +12,7 @@ import (
 
 func main() {
 	for filename, command := range commands.Commands {
-		c := testcli.GoRun("../main.go", append([]string{"../bundle.go", "../module.go", "../self_upgrade.go"}, command...)...)
+		c := testcli.GoRun("../main.go", append([]string{"../bundle.go", "../module.go", "../module_describe.go", "../migrate.go", "../export.go", "../export_helm.go", "../self_upgrade.go", "../test.go", "../version.go"}, command...)...)
 		c.Run()
 		if !c.Success() {
 			fmt.Fprintf(os.Stderr, "Command %v was expected to succeed, but failed with error: %s\n%s\n", command, c.Error(), c.StdoutAndStderr())
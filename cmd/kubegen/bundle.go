@@ -2,6 +2,7 @@ package main // import "github.com/errordeveloper/kubegen/cmd/kubegen"
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
 
@@ -11,6 +12,12 @@ import (
 
 var (
 	selectModules []string
+	explain       bool
+
+	printEffectiveBundle bool
+	frozen               bool
+
+	allowUndeclaredParameters bool
 )
 
 var bundleCmd = &cobra.Command{
@@ -22,6 +29,14 @@ var bundleCmd = &cobra.Command{
 func init() {
 	bundleCmd.Flags().StringSliceVarP(&selectModules, "module", "m", []string{},
 		"Names of modules to process (all modules in each given bundle are processed by defult)")
+	bundleCmd.Flags().BoolVar(&explain, "explain", false,
+		"Show values of parameters in each module and where they came from, instead of generating resources")
+	bundleCmd.Flags().BoolVar(&printEffectiveBundle, "print-effective-bundle", false,
+		"Show the bundle manifest with Extends resolved, instead of generating resources")
+	bundleCmd.Flags().BoolVar(&frozen, "frozen", false,
+		"Fail if any of the modules don't match "+modules.LockFileName+", instead of updating it")
+	bundleCmd.Flags().BoolVar(&allowUndeclaredParameters, "allow-undeclared-parameters", false,
+		"Warn about parameters that are not declared by the module, instead of failing (useful for migrations)")
 
 }
 
@@ -36,30 +51,90 @@ func bundleFn(cmd *cobra.Command, args []string) error {
 			return err
 		}
 
+		if printEffectiveBundle {
+			data, err := bundle.Encode(format)
+			if err != nil {
+				return err
+			}
+			if err := util.Dump(format, data); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if allowUndeclaredParameters {
+			bundle.AllowUndeclaredParameters()
+		}
+
+		if provenanceAnnotations {
+			bundle.AddProvenanceAnnotations()
+		}
+
+		if err := bundle.SetOutputLayout(layout); err != nil {
+			return err
+		}
+
+		if err := bundle.SetYAMLStyle(yamlStyle); err != nil {
+			return err
+		}
+
+		if err := bundle.SetJSONStyle(jsonStyle); err != nil {
+			return err
+		}
+
 		if err := bundle.LoadModules(selectModules); err != nil {
 			return err
 		}
 
+		if explain {
+			data, err := bundle.Explain()
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stdout.Write(data); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// the lock file is only updated along with the output directories,
+		// but it can be verified before printing the resources as well
+		if frozen {
+			if err := bundle.VerifyLockFile(); err != nil {
+				return err
+			}
+		} else if !stdout {
+			if err := bundle.UpdateLockFile(); err != nil {
+				return err
+			}
+		}
+
 		if !stdout {
 			wroteFiles, err := bundle.WriteToOutputDir(format)
 			if err != nil {
 				return err
 			}
+			printWarnings(bundle)
 
 			fmt.Printf("Wrote %d files based on bundle manifest %q", len(wroteFiles), manifest)
 
 			if len(wroteFiles) == 0 {
 				fmt.Printf(".\n")
-				return nil
+				return pruneOutputDirs(bundle)
 			}
 
 			fmt.Printf(":\n")
 			for _, file := range wroteFiles {
 				fmt.Printf("  – %s\n", file)
 			}
-			return nil
+			return pruneOutputDirs(bundle)
 		} else {
 			var data []byte
+
+			if maskSensitive {
+				bundle.MaskSensitiveValues()
+			}
+
 			switch format {
 			case "yaml":
 				if data, err = bundle.EncodeAllToYAML(); err != nil {
@@ -70,6 +145,7 @@ func bundleFn(cmd *cobra.Command, args []string) error {
 					return err
 				}
 			}
+			printWarnings(bundle)
 
 			if err := util.Dump(format, data); err != nil {
 				return err
@@ -79,3 +155,36 @@ func bundleFn(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// printWarnings reports issues that don't prevent generation of the resources, these
+// are printed separately, so that the output can be redirected to a file
+func printWarnings(bundle *modules.Bundle) {
+	for _, warning := range bundle.Warnings() {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+}
+
+// pruneOutputDirs removes stale files from output directories, unless --no-prune is set
+func pruneOutputDirs(bundle *modules.Bundle) error {
+	if noPrune {
+		return nil
+	}
+
+	removedFiles, err := bundle.Prune(pruneDryRun)
+	if err != nil {
+		return err
+	}
+	if len(removedFiles) == 0 {
+		return nil
+	}
+
+	if pruneDryRun {
+		fmt.Printf("Would remove %d stale files:\n", len(removedFiles))
+	} else {
+		fmt.Printf("Removed %d stale files:\n", len(removedFiles))
+	}
+	for _, file := range removedFiles {
+		fmt.Printf("  – %s\n", file)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+package main // import "github.com/errordeveloper/kubegen/cmd/kubegen"
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export [command]",
+	Short: "Export modules in formats other tools understand",
+}
@@ -0,0 +1,71 @@
+package main // import "github.com/errordeveloper/kubegen/cmd/kubegen"
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/spf13/cobra"
+
+	"github.com/errordeveloper/kubegen/pkg/modules"
+)
+
+var (
+	chartName, chartVersion, chartDir string
+)
+
+const (
+	defaultChartName = "$(basename <moduleSourceDir>)"
+	defaultChartDir  = "./<name>"
+)
+
+var exportHelmCmd = &cobra.Command{
+	Use:   "helm <moduleSourceDir>",
+	Short: "Export a module as a Helm chart, parameters become values",
+	RunE:  exportHelmFn,
+}
+
+func init() {
+	exportHelmCmd.Flags().StringVarP(&chartName, "name", "n", defaultChartName,
+		"Name of the chart")
+	exportHelmCmd.Flags().StringVar(&chartVersion, "chart-version", modules.HelmChartVersion,
+		"Version of the chart")
+	exportHelmCmd.Flags().StringVarP(&chartDir, "output-dir", "O", defaultChartDir,
+		"Directory to write the chart to")
+
+	exportCmd.AddCommand(exportHelmCmd)
+}
+
+func exportHelmFn(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("please provide module source directory")
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("only one module source directory needed")
+	}
+
+	// an error from here on is a report about the module, rather than about usage
+	cmd.SilenceUsage = true
+
+	if chartName == defaultChartName {
+		chartName = path.Base(args[0])
+	}
+	if chartDir == defaultChartDir {
+		chartDir = chartName
+	}
+
+	chart, err := modules.ExportHelmChart(args[0], chartName, chartVersion)
+	if err != nil {
+		return err
+	}
+
+	wroteFiles, err := chart.WriteToDir(chartDir)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d files of chart %q:\n", len(wroteFiles), chartName)
+	for _, file := range wroteFiles {
+		fmt.Printf("  – %s\n", file)
+	}
+	return nil
+}
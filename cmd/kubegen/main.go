@@ -2,13 +2,24 @@ package main // import "github.com/errordeveloper/kubegen/cmd/kubegen"
 
 import (
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
+
+	"github.com/errordeveloper/kubegen/pkg/modules"
 )
 
 var (
-	stdout bool
-	format string
+	stdout        bool
+	format        string
+	layout        string
+	yamlStyle     string
+	jsonStyle     string
+	maskSensitive bool
+
+	noPrune, pruneDryRun bool
+
+	provenanceAnnotations bool
 )
 
 func main() {
@@ -20,10 +31,28 @@ func main() {
 		"Output to stdout instead of creating files")
 	rootCmd.PersistentFlags().StringVarP(&format, "output", "o", "yaml",
 		"Output format [\"yaml\" or \"json\"]")
+	rootCmd.PersistentFlags().StringVar(&yamlStyle, "yaml-style", modules.YAMLStyleList,
+		"How objects are put together in YAML output [\""+strings.Join(modules.YAMLStyles, "\", \"")+"\"]")
+	rootCmd.PersistentFlags().StringVar(&jsonStyle, "json-style", modules.JSONStyleList,
+		"How objects are put together in JSON output [\""+strings.Join(modules.JSONStyles, "\", \"")+"\"]")
+	rootCmd.PersistentFlags().StringVar(&layout, "layout", modules.LayoutPerManifest,
+		"Layout of the output directory [\""+strings.Join(modules.OutputLayouts, "\", \"")+"\"] (only without --stdout)")
+	rootCmd.PersistentFlags().BoolVar(&noPrune, "no-prune", false,
+		"Keep files that were generated previously, but aren't generated anymore (these are removed by default, only without --stdout)")
+	rootCmd.PersistentFlags().BoolVar(&pruneDryRun, "prune-dry-run", false,
+		"Show files that would be pruned, instead of removing them")
+	rootCmd.PersistentFlags().BoolVar(&provenanceAnnotations, "provenance-annotations", false,
+		"Annotate each object with version of kubegen and source hash of the module instance")
+	rootCmd.PersistentFlags().BoolVar(&maskSensitive, "mask-sensitive", false,
+		"Mask values of sensitive parameters in objects other than Secrets (only with --stdout)")
 
 	rootCmd.AddCommand(bundleCmd)
 	rootCmd.AddCommand(moduleCmd)
+	rootCmd.AddCommand(migrateCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(testCmd)
 	rootCmd.AddCommand(selfUpgradeCmd)
+	rootCmd.AddCommand(versionCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
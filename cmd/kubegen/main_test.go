@@ -18,7 +18,7 @@ func TestKubegenCmd(t *testing.T) {
 	for filename, command := range commands.Commands {
 		t.Run(fmt.Sprintf("args=[%v]", command), func(t *testing.T) {
 			t.Parallel()
-			c := testcli.GoRunMain(append([]string{"bundle.go", "module.go", "self_upgrade.go"}, command...)...)
+			c := testcli.GoRunMain(append([]string{"bundle.go", "module.go", "module_describe.go", "migrate.go", "export.go", "export_helm.go", "self_upgrade.go", "test.go", "version.go"}, command...)...)
 			c.Run()
 			if !c.Success() {
 				t.Fatalf("Command %v was expected to succeed, but failed with error: %s\n%s\n", command, c.Error(), c.StdoutAndStderr())
@@ -0,0 +1,63 @@
+package main // import "github.com/errordeveloper/kubegen/cmd/kubegen"
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/errordeveloper/kubegen/pkg/modules"
+)
+
+var migrateDryRun bool
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate <path> ...",
+	Short: "Upgrade bundle and module manifests of older versions to the latest one",
+	RunE:  migrateFn,
+}
+
+func init() {
+	migrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false,
+		"Show which files would be migrated, instead of rewriting them")
+}
+
+func migrateFn(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("please provide at least one file or directory")
+	}
+
+	migrated := 0
+	for _, arg := range args {
+		manifests, err := modules.FindManifestFiles(arg)
+		if err != nil {
+			return err
+		}
+
+		for _, manifest := range manifests {
+			from, to, warnings, err := modules.MigrateFile(manifest, migrateDryRun)
+			if err != nil {
+				return err
+			}
+			if from == "" {
+				continue
+			}
+			migrated++
+
+			if migrateDryRun {
+				fmt.Printf("Would migrate %q from %q to %q\n", manifest, from, to)
+			} else {
+				fmt.Printf("Migrated %q from %q to %q\n", manifest, from, to)
+			}
+			for _, warning := range warnings {
+				fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+			}
+		}
+	}
+
+	if migrated == 0 {
+		fmt.Printf("All manifests are up to date.\n")
+	}
+
+	return nil
+}
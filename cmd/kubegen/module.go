@@ -1,22 +1,27 @@
 package main // import "github.com/errordeveloper/kubegen/cmd/kubegen"
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/spf13/cobra"
-	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"github.com/errordeveloper/kubegen/pkg/modules"
 	"github.com/errordeveloper/kubegen/pkg/util"
 )
 
+var looksLikeMoreParameters = regexp.MustCompile(`,\s*[A-Za-z_][A-Za-z0-9_]*=`)
+
 var (
-	module     modules.ModuleInstance
-	parameters []string
+	module      modules.ModuleInstance
+	parameters  []string
+	valuesFiles []string
 )
 
 const (
@@ -38,9 +43,18 @@ func init() {
 		"Name of the module instance (optional)")
 	moduleCmd.Flags().StringVarP(&module.Namespace, "namespace", "N", "",
 		"Namespace of the module instance (optional)")
-
-	moduleCmd.Flags().StringSliceVarP(&parameters, "parameters", "p", []string{},
-		"Parameters to set for the module instance")
+	moduleCmd.Flags().StringVar(&module.NamePrefix, "name-prefix", "",
+		"Prefix to add to names of all objects in the module instance (optional)")
+	moduleCmd.Flags().StringVar(&module.NameSuffix, "name-suffix", "",
+		"Suffix to add to names of all objects in the module instance (optional)")
+
+	// each flag sets one parameter, as values may contain commas and quotes
+	moduleCmd.Flags().StringArrayVarP(&parameters, "parameters", "p", []string{},
+		"Parameter to set for the module instance, can be given more than once, as values are not split on commas (values are parsed as JSON scalars, so a string that looks like a number must be quoted, e.g. -p 'version=\"1\"')")
+	moduleCmd.Flags().StringSliceVarP(&valuesFiles, "values", "f", []string{},
+		"Files with parameters to set for the module instance (YAML, JSON or HCL, merged in order, before --parameters)")
+	moduleCmd.Flags().BoolVar(&allowUndeclaredParameters, "allow-undeclared-parameters", false,
+		"Warn about parameters that are not declared by the module, instead of failing (useful for migrations)")
 }
 
 func moduleFn(cmd *cobra.Command, args []string) error {
@@ -75,10 +89,27 @@ func moduleFn(cmd *cobra.Command, args []string) error {
 		module.OutputDir = module.Name
 	}
 
-	if len(parameters) > 0 {
+	if len(parameters) > 0 || len(valuesFiles) > 0 {
 		module.Parameters = make(map[string]interface{})
 	}
 
+	for _, valuesFile := range valuesFiles {
+		data, err := ioutil.ReadFile(valuesFile)
+		if err != nil {
+			return fmt.Errorf("error reading values file %q – %v", valuesFile, err)
+		}
+
+		values := make(map[string]interface{})
+		if err := util.LoadObj(&values, data, valuesFile, ""); err != nil {
+			return err
+		}
+
+		// values from each of the files override values from the previous ones
+		for k, v := range values {
+			module.Parameters[k] = v
+		}
+	}
+
 	for _, v := range parameters {
 		kv := strings.SplitN(v, "=", 2)
 		if len(kv) < 2 {
@@ -89,19 +120,37 @@ func moduleFn(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("invalid parameter value %q, expected a non-empty string", v)
 		}
 
-		// TODO: intstr is really not good for us, it makes floats into strings and that's
-		// going to surprise the users, parsing it as JSON value is a better idea
-		v := intstr.Parse(kv[1])
-		switch v.Type {
-		case intstr.Int:
-			module.Parameters[kv[0]] = v.IntValue()
-		case intstr.String:
-			module.Parameters[kv[0]] = v.String()
+		// -p used to take a comma-separated list, so catch values that would silently set only one parameter
+		if !strings.HasPrefix(kv[1], `"`) && looksLikeMoreParameters.MatchString(kv[1]) {
+			return fmt.Errorf("invalid parameter value %q, it looks like it sets more than one parameter – "+
+				"use a separate flag for each of the parameters, or quote the value if it's a string, e.g. -p '%s=\"%s\"'", v, kv[0], kv[1])
 		}
+
+		module.Parameters[kv[0]] = parseParameterValue(kv[1])
 	}
 
 	bundle := &modules.Bundle{Modules: []modules.ModuleInstance{module}}
 
+	if allowUndeclaredParameters {
+		bundle.AllowUndeclaredParameters()
+	}
+
+	if provenanceAnnotations {
+		bundle.AddProvenanceAnnotations()
+	}
+
+	if err := bundle.SetOutputLayout(layout); err != nil {
+		return err
+	}
+
+	if err := bundle.SetYAMLStyle(yamlStyle); err != nil {
+		return err
+	}
+
+	if err := bundle.SetJSONStyle(jsonStyle); err != nil {
+		return err
+	}
+
 	if err := bundle.LoadModules(nil); err != nil {
 		return err
 	}
@@ -111,24 +160,30 @@ func moduleFn(cmd *cobra.Command, args []string) error {
 		if err != nil {
 			return err
 		}
+		printWarnings(bundle)
 
 		fmt.Printf("Wrote %d files", len(wroteFiles))
 
 		if len(wroteFiles) == 0 {
 			fmt.Printf(".\n")
-			return nil
+			return pruneOutputDirs(bundle)
 		}
 
 		fmt.Printf(":\n")
 		for _, file := range wroteFiles {
 			fmt.Printf("  – %s\n", file)
 		}
-		return nil
+		return pruneOutputDirs(bundle)
 	} else {
 		var (
 			data []byte
 			err  error
 		)
+
+		if maskSensitive {
+			bundle.MaskSensitiveValues()
+		}
+
 		switch format {
 		case "yaml":
 			if data, err = bundle.EncodeAllToYAML(); err != nil {
@@ -139,6 +194,7 @@ func moduleFn(cmd *cobra.Command, args []string) error {
 				return err
 			}
 		}
+		printWarnings(bundle)
 
 		if err := util.Dump(format, data); err != nil {
 			return err
@@ -147,3 +203,18 @@ func moduleFn(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// parseParameterValue treats the value as a JSON scalar, so that numbers and booleans
+// get the type one would expect, anything that isn't valid JSON is taken as a string
+func parseParameterValue(s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return s
+	}
+	switch v.(type) {
+	case float64, bool, string:
+		return v
+	default:
+		return s
+	}
+}
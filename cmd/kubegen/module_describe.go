@@ -0,0 +1,64 @@
+package main // import "github.com/errordeveloper/kubegen/cmd/kubegen"
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/errordeveloper/kubegen/pkg/modules"
+)
+
+var describeFormat string
+
+var moduleDescribeCmd = &cobra.Command{
+	Use:   "describe <moduleSourceDir>",
+	Short: "Describe parameters, internals and outputs declared in a module",
+	RunE:  moduleDescribeFn,
+}
+
+func init() {
+	moduleDescribeCmd.Flags().StringVar(&describeFormat, "format", "table",
+		"Format of the description [\"table\", \"json\" or \"markdown\"]")
+
+	moduleCmd.AddCommand(moduleDescribeCmd)
+}
+
+func moduleDescribeFn(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("please provide module source directory")
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("only one module source directory needed")
+	}
+
+	m, err := modules.NewModule(args[0], "")
+	if err != nil {
+		return err
+	}
+
+	description := m.Describe()
+
+	var data []byte
+	switch describeFormat {
+	case "table":
+		data, err = description.EncodeToTable()
+	case "json":
+		data, err = description.EncodeToJSON()
+	case "markdown":
+		data, err = description.EncodeToMarkdown()
+	default:
+		return fmt.Errorf("unknown format %q, only \"table\", \"json\" and \"markdown\" are supported", describeFormat)
+	}
+	if err != nil {
+		return err
+	}
+
+	// duplicates are reported separately, so that the output can be redirected to a file
+	for _, duplicate := range description.Duplicates {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", duplicate)
+	}
+
+	_, err = os.Stdout.Write(data)
+	return err
+}
@@ -0,0 +1,109 @@
+package main // import "github.com/errordeveloper/kubegen/cmd/kubegen"
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/errordeveloper/kubegen/pkg/modules"
+)
+
+var (
+	updateExpected bool
+	selectTests    []string
+)
+
+var testCmd = &cobra.Command{
+	Use:   "test <moduleSourceDir>",
+	Short: "Run tests of a module and compare generated resources with expected outputs",
+	RunE:  testFn,
+}
+
+func init() {
+	testCmd.Flags().BoolVar(&updateExpected, "update", false,
+		"Write generated resources to files with expected outputs, instead of comparing them")
+	testCmd.Flags().StringSliceVarP(&selectTests, "test", "t", []string{},
+		"Names of tests to run (all tests are run by default)")
+}
+
+func testFn(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("please provide module source directory")
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("only one module source directory needed")
+	}
+
+	tests, err := modules.LoadModuleTests(args[0])
+	if err != nil {
+		return err
+	}
+	if tests == nil {
+		return fmt.Errorf("module %q has no tests, expected one of %v in %q",
+			args[0], modules.ModuleTestsFileNames, modules.TestsDirName)
+	}
+
+	// failing tests are not a usage error
+	cmd.SilenceUsage = true
+
+	// paths of the manifests are part of the output, so the tests are run from within
+	// the module directory, as otherwise the output would depend on the working directory
+	if err := os.Chdir(args[0]); err != nil {
+		return err
+	}
+
+	ran, failed := 0, 0
+	for _, test := range tests.Tests {
+		if len(selectTests) > 0 && !contains(selectTests, test.Name) {
+			continue
+		}
+		ran++
+
+		result, err := test.Run(".")
+		if err != nil {
+			return err
+		}
+		for _, warning := range result.Warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
+
+		if result.Passed() {
+			fmt.Printf("ok      %s\n", test.Name)
+			continue
+		}
+
+		if updateExpected {
+			if err := result.Update(); err != nil {
+				return err
+			}
+			fmt.Printf("updated %s (%s)\n", test.Name, result.ExpectedPath)
+			continue
+		}
+
+		failed++
+		if result.Expected == nil {
+			fmt.Printf("FAIL    %s – %q doesn't exist, run with --update to create it\n", test.Name, result.ExpectedPath)
+			continue
+		}
+		diff, err := result.Diff()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("FAIL    %s – output differs from %q:\n%s\n", test.Name, result.ExpectedPath, diff)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tests failed", failed, ran)
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,20 @@
+package main // import "github.com/errordeveloper/kubegen/cmd/kubegen"
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/errordeveloper/kubegen/pkg/version"
+)
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Show version of kubegen",
+	RunE:  versionFn,
+}
+
+func versionFn(cmd *cobra.Command, args []string) error {
+	fmt.Printf("kubegen version %s\n", version.Version)
+	return nil
+}
@@ -3,4 +3,6 @@ kind = "kubegen.k8s.io/Module.v1alpha2"
 parameter "service_token" {
   type = "String"
   required = true
+  sensitive = true
+  description = "Service token of your Weave Cloud instance"
 }
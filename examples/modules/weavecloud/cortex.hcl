@@ -24,12 +24,12 @@ deployment "weave-cortex-agent" {
         container_port = 8080
         protocol = "TCP"
       }
-      mount "agent-config-volume-config" {
+      mount "weave-cortex-agent-config" {
         mount_path = "/etc/prometheus"
       }
   }
 
-  volume "agent-config-volume-config" {
+  volume "weave-cortex-agent-config" {
     configmap { }
   }
 }
@@ -0,0 +1 @@
+service_token = "abc123"
@@ -50,6 +50,8 @@ type Converter struct {
 	macrosEvalPhase MacrosEvalPhase
 	// modifiers are actual modifiers mapped by path
 	modifiers map[string]*Modifier
+	// mergeKeys override DefaultMergeKeys when set
+	mergeKeys []string
 }
 
 func New() *Converter {
@@ -92,6 +94,9 @@ func (c *Converter) LoadObject(data []byte, sourcePath string, instanceName stri
 	return err
 }
 
+// LoadJSON loads an object that was encoded as JSON, regardless of where it came from
+func (c *Converter) LoadJSON(data []byte) error { return c.loadStrict(data) }
+
 func (c *Converter) UnloadObject(obj interface{}, sourcePath string, instanceName string) error {
 	jsonData, err := c.MarshalJSON()
 	if err != nil {
@@ -280,6 +285,16 @@ func (b *BranchLocator) Refresh(c *Converter) error {
 	return nil
 }
 
+// IsNestedIn checks whether any of the parents is the given macro
+func (b *BranchLocator) IsNestedIn(m *Macro) bool {
+	for _, k := range b.path[1 : len(b.path)-1] {
+		if k == m.String() {
+			return true
+		}
+	}
+	return false
+}
+
 func (b *BranchLocator) Kind() ValueType { return b.kind }
 
 func (b *BranchLocator) Value() *Tree { return b.value }
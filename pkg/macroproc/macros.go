@@ -44,6 +44,13 @@ var (
 		VerbName:   "If",
 	}
 
+	MacroArrayForEach = &Macro{
+		ReturnType: Array,
+		EvalPhase:  MacrosEvalPhaseA,
+		VerbName:   "ForEach",
+		Splice:     true,
+	}
+
 	// Phase B – lookups
 
 	MacroBooleanLookup = &Macro{
@@ -190,6 +197,145 @@ func MakeModifierStringAsBASE64(_ *Converter, _ *BranchLocator, _ *Macro) (Modif
 	return cb, nil
 }
 
+// ForEach holds arguments of kubegen.Array.ForEach, it instantiates
+// the template once for each element of a literal array attribute,
+// with the element (and optionally its index) bound to attributes
+// that can be looked up from within the template
+type ForEach struct {
+	In       string
+	As       string
+	Index    string
+	Template interface{}
+}
+
+func NewForEach(branch *BranchLocator) (*ForEach, error) {
+	args, err := branch.Value().GetObject()
+	if err != nil {
+		return nil, err
+	}
+
+	f := &ForEach{}
+	for k, v := range args {
+		switch k {
+		case "in", "as", "index":
+			s, ok := v.(string)
+			if !ok || s == "" {
+				return nil, fmt.Errorf("in %q argument %q must be a non-empty string", branch.PathToString(), k)
+			}
+			switch k {
+			case "in":
+				f.In = s
+			case "as":
+				f.As = s
+			case "index":
+				f.Index = s
+			}
+		case "template":
+			f.Template = v
+		default:
+			return nil, fmt.Errorf("in %q unknown argument %q", branch.PathToString(), k)
+		}
+	}
+
+	switch {
+	case f.In == "":
+		return nil, fmt.Errorf("in %q argument \"in\" must be set", branch.PathToString())
+	case f.As == "":
+		return nil, fmt.Errorf("in %q argument \"as\" must be set", branch.PathToString())
+	case f.Template == nil:
+		return nil, fmt.Errorf("in %q argument \"template\" must be set", branch.PathToString())
+	case f.As == f.Index:
+		return nil, fmt.Errorf("in %q arguments \"as\" and \"index\" must be different", branch.PathToString())
+	}
+
+	return f, nil
+}
+
+// Instantiate makes a copy of the template, where lookups of names
+// that are bound by this iteration are renamed according to bindings
+func (f *ForEach) Instantiate(bindings map[string]string) interface{} {
+	return rebindLookups(f.Template, bindings)
+}
+
+func isLookupKey(k string) bool {
+	return strings.HasPrefix(k, "kubegen.") && strings.HasSuffix(k, ".Lookup")
+}
+
+func rebindLookups(v interface{}, bindings map[string]string) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		y := make(map[string]interface{}, len(x))
+		for k, e := range x {
+			if s, ok := e.(string); ok && isLookupKey(k) {
+				if b, ok := bindings[s]; ok {
+					y[k] = b
+					continue
+				}
+			}
+			if args, ok := e.(map[string]interface{}); ok && k == MacroArrayForEach.String() {
+				y[k] = rebindForEachArgs(args, bindings)
+				continue
+			}
+			y[k] = rebindLookups(e, bindings)
+		}
+		return y
+	case []interface{}:
+		y := make([]interface{}, len(x))
+		for k, e := range x {
+			y[k] = rebindLookups(e, bindings)
+		}
+		return y
+	default:
+		return v
+	}
+}
+
+// rebindForEachArgs handles nested iteration, which may iterate over
+// an element bound by the outer one, and may also shadow the names
+func rebindForEachArgs(args map[string]interface{}, bindings map[string]string) map[string]interface{} {
+	y := make(map[string]interface{}, len(args))
+	for k, e := range args {
+		y[k] = e
+	}
+
+	if s, ok := args["in"].(string); ok {
+		if b, ok := bindings[s]; ok {
+			y["in"] = b
+		}
+	}
+
+	if template, ok := args["template"]; ok {
+		shadowed := make(map[string]string, len(bindings))
+		for k, v := range bindings {
+			if k != args["as"] && k != args["index"] {
+				shadowed[k] = v
+			}
+		}
+		y["template"] = rebindLookups(template, shadowed)
+	}
+
+	return y
+}
+
+// IsLiteral is true when there are no macros in the given value
+func IsLiteral(v interface{}) bool {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, e := range x {
+			if strings.HasPrefix(k, "kubegen.") || !IsLiteral(e) {
+				return false
+			}
+		}
+	case []interface{}:
+		for _, e := range x {
+			if !IsLiteral(e) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func doLoadJSON(c *Converter, branch *BranchLocator, m *Macro, newData []byte) error {
 	/*
 		var (
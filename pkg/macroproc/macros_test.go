@@ -937,6 +937,159 @@ func _TestMacroLoadJSON(t *testing.T) {
 	}
 }
 
+func TestMacroArrayForEach(t *testing.T) {
+	conv := New()
+
+	assert := assert.New(t)
+
+	tobj := []byte(`{
+		"Kind": "Some",
+		"services": [
+			{ "name": "first" },
+			{
+				"kubegen.Array.ForEach": {
+					"in": "zones",
+					"as": "zone",
+					"index": "n",
+					"template": {
+						"name": { "kubegen.String.Lookup": "zone" },
+						"index": { "kubegen.Number.Lookup": "n" },
+						"ports": [
+							{
+								"kubegen.Array.ForEach": {
+									"in": "ports",
+									"as": "port",
+									"template": {
+										"zone": { "kubegen.String.Lookup": "zone" },
+										"port": { "kubegen.Number.Lookup": "port" }
+									}
+								}
+							}
+						]
+					}
+				}
+			},
+			{ "name": "last" }
+		],
+		"ports": {
+			"kubegen.Array.ForEach": {
+				"in": "ports",
+				"as": "zone",
+				"template": { "kubegen.Number.Lookup": "zone" }
+			}
+		},
+		"none": [
+			{
+				"kubegen.Array.ForEach": {
+					"in": "empty",
+					"as": "x",
+					"template": "x"
+				}
+			}
+		]
+	}`)
+
+	attributes := map[string]interface{}{
+		"zones": []interface{}{"a", "b"},
+		"ports": []interface{}{80, 443},
+		"empty": []interface{}{},
+	}
+
+	lookup := func(c *Converter, branch *BranchLocator, _ *Macro) (ModifierCallback, error) {
+		cb := func(m *Modifier, c *Converter) error {
+			v, ok := attributes[*m.Branch.StringValue()]
+			if !ok {
+				return fmt.Errorf("undeclared attribute %q", *m.Branch.StringValue())
+			}
+			return c.Set(m.Branch, v)
+		}
+		return c.TypeCheckModifier(branch, String, cb)
+	}
+
+	conv.DefineMacro(MacroStringLookup, lookup)
+	conv.DefineMacro(MacroNumberLookup, lookup)
+
+	conv.DefineMacro(MacroArrayForEach,
+		func(c *Converter, branch *BranchLocator, _ *Macro) (ModifierCallback, error) {
+			cb := func(m *Modifier, c *Converter) error {
+				if m.Branch.IsNestedIn(m.Macro) {
+					return nil
+				}
+				f, err := NewForEach(m.Branch)
+				if err != nil {
+					return err
+				}
+				bind := func(name string, value interface{}) string {
+					k := fmt.Sprintf("%s#%d", name, len(attributes))
+					attributes[k] = value
+					return k
+				}
+				result := []interface{}{}
+				for n, item := range attributes[f.In].([]interface{}) {
+					bindings := map[string]string{f.As: bind(f.As, item)}
+					if f.Index != "" {
+						bindings[f.Index] = bind(f.Index, n)
+					}
+					result = append(result, f.Instantiate(bindings))
+				}
+				return c.Splice(m.Branch, result)
+			}
+			return c.TypeCheckModifier(branch, Object, cb)
+		})
+
+	if err := conv.loadStrict(tobj); err != nil {
+		t.Fatalf("failed to laod – %v\ntree=%s", err, conv.tree)
+	}
+
+	if err := conv.Run(); err != nil {
+		t.Fatalf("failed to run converter – %v", err)
+	}
+
+	{
+		v, err := conv.tree.GetArray("services")
+		assert.Nil(err)
+
+		js, err := json.Marshal(v)
+		assert.Nil(err)
+
+		assert.JSONEq(`[
+			{ "name": "first" },
+			{
+				"name": "a",
+				"index": 0,
+				"ports": [ { "zone": "a", "port": 80 }, { "zone": "a", "port": 443 } ]
+			},
+			{
+				"name": "b",
+				"index": 1,
+				"ports": [ { "zone": "b", "port": 80 }, { "zone": "b", "port": 443 } ]
+			},
+			{ "name": "last" }
+		]`, string(js))
+	}
+
+	{
+		v, err := conv.tree.GetArray("ports")
+		assert.Nil(err)
+
+		js, err := json.Marshal(v)
+		assert.Nil(err)
+
+		assert.JSONEq(`[ 80, 443 ]`, string(js))
+	}
+
+	{
+		v, err := conv.tree.GetArray("none")
+		assert.Nil(err)
+		assert.Len(v, 0)
+	}
+
+	{
+		assert.True(IsLiteral(attributes["zones"]))
+		assert.False(IsLiteral([]interface{}{map[string]interface{}{"kubegen.String.Lookup": "zone"}}))
+	}
+}
+
 /*
 func TestAllAttributes(t *testing.T) {
 	tobj := []byte(`{
@@ -4,6 +4,21 @@ import (
 	"fmt"
 )
 
+// Patch directives can be set in the target of an overlay to change how
+// a particular object or array gets merged, they are modelled after the
+// directives used in Kubernetes strategic merge patches
+const (
+	PatchDirectiveKey     = "$patch"
+	PatchDirectiveMerge   = "merge"
+	PatchDirectiveReplace = "replace"
+	PatchDirectiveDelete  = "delete"
+)
+
+// DefaultMergeKeys are used to match elements of arrays of objects during
+// an overlay, the first key that is set in every element of both arrays and
+// has a unique value in each of the arrays is used
+var DefaultMergeKeys = []string{"name", "mountPath", "containerPort"}
+
 // getPathCutoffIndex is unused, but we have a test for it and it may come handy
 func (t *Tree) getPathCutoffIndex(keys ...interface{}) int {
 	x := -1
@@ -30,7 +45,192 @@ func (t *Tree) Overlay(source *Tree, keys ...interface{}) error {
 		return fmt.Errorf("source.self cannot be nil")
 	}
 
-	return targetSubtree.overlay(source)
+	if err := targetSubtree.overlay(source); err != nil {
+		return err
+	}
+
+	// any directives that are left had nothing to be merged with, and
+	// should not get into the output; the subtree has to be looked up
+	// again, as overlay may have replaced it
+	targetSubtree, err = t.Get(keys...)
+	if err != nil {
+		return fmt.Errorf("cannot overlay at path %v – %v", keys, err)
+	}
+	targetSubtree.rootLock()
+	v := stripPatchDirectives(targetSubtree.self)
+	targetSubtree.rootUnlock()
+
+	targetSubtree.setValue(v)
+	targetSubtree.self = v
+
+	return nil
+}
+
+// SetMergeKeys overrides DefaultMergeKeys for overlays onto this tree,
+// it should be called on the root of the tree
+func (t *Tree) SetMergeKeys(keys ...string) { t.mergeKeys = keys }
+
+func (t *Tree) getMergeKeys() []string {
+	if t.root != nil && t.root.mergeKeys != nil {
+		return t.root.mergeKeys
+	}
+	if t.mergeKeys != nil {
+		return t.mergeKeys
+	}
+	return DefaultMergeKeys
+}
+
+func getPatchDirective(v interface{}) string {
+	if x, ok := v.(map[string]interface{}); ok {
+		if d, ok := x[PatchDirectiveKey].(string); ok {
+			return d
+		}
+	}
+	return ""
+}
+
+// isArrayPatchDirective is true for elements like `{ "$patch": "replace" }`,
+// which apply to the whole array, rather than to the element itself
+func isArrayPatchDirective(v interface{}) bool {
+	x, ok := v.(map[string]interface{})
+	return ok && len(x) == 1 && getPatchDirective(x) != ""
+}
+
+func stripPatchDirectives(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		delete(x, PatchDirectiveKey)
+		for k := range x {
+			x[k] = stripPatchDirectives(x[k])
+		}
+		return x
+	case []interface{}:
+		y := make([]interface{}, 0, len(x))
+		for _, e := range x {
+			if isArrayPatchDirective(e) || getPatchDirective(e) == PatchDirectiveDelete {
+				continue
+			}
+			y = append(y, stripPatchDirectives(e))
+		}
+		return y
+	default:
+		return v
+	}
+}
+
+func isMergeKeyValue(v interface{}) bool {
+	vt := getValueType(v)
+	return vt != nil && (*vt == String || *vt == Number || *vt == Boolean)
+}
+
+// findMergeKey returns a key that can be used to merge target and source
+// arrays by matching elements, or an empty string if there isn't one
+func findMergeKey(keys []string, target, source []interface{}) string {
+	hasKey := func(key string, x []interface{}) bool {
+		seen := make(map[interface{}]bool, len(x))
+		for _, e := range x {
+			if isArrayPatchDirective(e) {
+				continue
+			}
+			obj, ok := e.(map[string]interface{})
+			if !ok {
+				return false
+			}
+			v, ok := obj[key]
+			if !ok || !isMergeKeyValue(v) || seen[v] {
+				return false
+			}
+			seen[v] = true
+		}
+		return true
+	}
+
+	if len(target)+len(source) == 0 {
+		return ""
+	}
+
+	for _, key := range keys {
+		if hasKey(key, target) && hasKey(key, source) {
+			return key
+		}
+	}
+	return ""
+}
+
+func hasArrayPatchDirective(x []interface{}, directive string) bool {
+	for _, e := range x {
+		if isArrayPatchDirective(e) && getPatchDirective(e) == directive {
+			return true
+		}
+	}
+	return false
+}
+
+// overlayArrayByKey merges elements of source onto elements of the target
+// that have the same value of the merge key, elements that are only present
+// in the source are kept in the order they appear in, and elements only
+// present in the target are appended; an element with `"$patch": "delete"`
+// in the target removes matching element of the source
+func (t *Tree) overlayArrayByKey(key string, target, source []interface{}) error {
+	targetElements := make(map[interface{}]interface{}, len(target))
+	deleted := make(map[interface{}]bool)
+	for _, e := range target {
+		if isArrayPatchDirective(e) {
+			continue
+		}
+		k := e.(map[string]interface{})[key]
+		if getPatchDirective(e) == PatchDirectiveDelete {
+			deleted[k] = true
+			continue
+		}
+		targetElements[k] = e
+	}
+
+	type pair struct {
+		index  int
+		source interface{}
+	}
+
+	merged := make([]interface{}, 0, len(target)+len(source))
+	matched := make(map[interface{}]bool)
+	pending := []pair{}
+
+	for _, e := range source {
+		k := e.(map[string]interface{})[key]
+		if deleted[k] {
+			continue
+		}
+		if targetElement, ok := targetElements[k]; ok {
+			pending = append(pending, pair{len(merged), e})
+			merged = append(merged, targetElement)
+			matched[k] = true
+			continue
+		}
+		merged = append(merged, e)
+	}
+
+	for _, e := range target {
+		if isArrayPatchDirective(e) || getPatchDirective(e) == PatchDirectiveDelete {
+			continue
+		}
+		if !matched[e.(map[string]interface{})[key]] {
+			merged = append(merged, e)
+		}
+	}
+
+	t.setValue(merged)
+	t.self = merged
+
+	for _, p := range pending {
+		targetSubtree, err := t.Get(p.index)
+		if err != nil {
+			return err
+		}
+		if err := targetSubtree.overlay(NewTree(&p.source)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (t *Tree) overlayHere(newKey interface{}, newValue interface{}) error {
@@ -92,6 +292,29 @@ func (t *Tree) replaceEmptiedObjectWithArray(source *Tree) error {
 }
 
 func (t *Tree) overlay(source *Tree) error {
+	switch target := t.self.(type) {
+	case map[string]interface{}:
+		if getPatchDirective(target) == PatchDirectiveReplace {
+			// target replaces the source entirely, so there is nothing to do
+			t.rootLock()
+			delete(target, PatchDirectiveKey)
+			t.rootUnlock()
+			return nil
+		}
+	case []interface{}:
+		if source, ok := source.self.([]interface{}); ok {
+			if hasArrayPatchDirective(target, PatchDirectiveReplace) {
+				return nil
+			}
+			key := findMergeKey(t.getMergeKeys(), target, source)
+			// arrays are only overlayed by position when elements cannot be matched by key,
+			// otherwise an element that is new would overwrite an element of the source
+			if key != "" {
+				return t.overlayArrayByKey(key, target, source)
+			}
+		}
+	}
+
 	// for each key in source, attempt to overlay it onto the target
 	iterateSource := func(key interface{}, value interface{}, vt ValueType) error {
 		// log.Printf("<t:%s>.Get(<k:%v>)", t, key)
@@ -553,3 +553,173 @@ func TestTreeOverlayWithObjectOnly(t *testing.T) {
 		}
 	}
 }
+
+func TestTreeOverlayArraysByKey(t *testing.T) {
+	assert := assert.New(t)
+
+	tobj := []byte(`{
+		"Kind": "Some",
+		"deployment": {
+			"containers": [
+				{ "name": "sidecar", "image": "sidecar:2.0" },
+				{ "name": "extra", "image": "extra:1.0" },
+				{ "name": "debug", "$patch": "delete" }
+			],
+			"volumes": [
+				{ "name": "config", "configMap": { "name": "other" }, "$patch": "replace" }
+			],
+			"args": [ "--foo" ],
+			"ports": [
+				{ "$patch": "replace" },
+				{ "name": "https", "containerPort": 443 }
+			],
+			"env": [
+				{ "name": "IGNORED", "$patch": "delete" }
+			],
+			"initContainers": [
+				{ "name": "init-override", "image": "init:2.0" }
+			]
+		}
+	}`)
+
+	sobj := []byte(`{
+		"containers": [
+			{ "name": "app", "image": "app:1.0", "ports": [ { "name": "http", "containerPort": 80 } ] },
+			{ "name": "sidecar", "image": "sidecar:1.0", "args": [ "--verbose" ] },
+			{ "name": "debug", "image": "debug:1.0" }
+		],
+		"volumes": [
+			{ "name": "config", "configMap": { "name": "config", "defaultMode": 420 } },
+			{ "name": "tmp", "emptyDir": {} }
+		],
+		"args": [ "--bar", "--baz" ],
+		"ports": [
+			{ "name": "http", "containerPort": 80 }
+		],
+		"initContainers": [
+			{ "name": "init", "image": "init:1.0", "args": [ "--once" ] }
+		]
+	}`)
+
+	target, err := loadObject(tobj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := loadObject(sobj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := target.Overlay(source, "deployment"); err != nil {
+		t.Fatal(err)
+	}
+
+	{
+		v, err := target.GetArray("deployment", "containers")
+		assert.Nil(err)
+
+		js, err := json.Marshal(v)
+		assert.Nil(err)
+
+		assert.JSONEq(`[
+			{ "name": "app", "image": "app:1.0", "ports": [ { "name": "http", "containerPort": 80 } ] },
+			{ "name": "sidecar", "image": "sidecar:2.0", "args": [ "--verbose" ] },
+			{ "name": "extra", "image": "extra:1.0" }
+		]`, string(js))
+	}
+
+	{
+		v, err := target.GetArray("deployment", "volumes")
+		assert.Nil(err)
+
+		js, err := json.Marshal(v)
+		assert.Nil(err)
+
+		assert.JSONEq(`[
+			{ "name": "config", "configMap": { "name": "other" } },
+			{ "name": "tmp", "emptyDir": {} }
+		]`, string(js))
+	}
+
+	{
+		v, err := target.GetArray("deployment", "args")
+		assert.Nil(err)
+
+		js, err := json.Marshal(v)
+		assert.Nil(err)
+
+		assert.JSONEq(`[ "--foo", "--baz" ]`, string(js))
+	}
+
+	{
+		v, err := target.GetArray("deployment", "ports")
+		assert.Nil(err)
+
+		js, err := json.Marshal(v)
+		assert.Nil(err)
+
+		assert.JSONEq(`[ { "name": "https", "containerPort": 443 } ]`, string(js))
+	}
+
+	{
+		v, err := target.GetArray("deployment", "env")
+		assert.Nil(err)
+
+		js, err := json.Marshal(v)
+		assert.Nil(err)
+
+		assert.JSONEq(`[]`, string(js))
+	}
+
+	{
+		// nothing matches by key, so the new element is appended
+		v, err := target.GetArray("deployment", "initContainers")
+		assert.Nil(err)
+
+		js, err := json.Marshal(v)
+		assert.Nil(err)
+
+		assert.JSONEq(`[
+			{ "name": "init", "image": "init:1.0", "args": [ "--once" ] },
+			{ "name": "init-override", "image": "init:2.0" }
+		]`, string(js))
+	}
+}
+
+func TestTreeOverlayArraysByCustomKey(t *testing.T) {
+	assert := assert.New(t)
+
+	tobj := []byte(`{
+		"Kind": "Some",
+		"test": {
+			"items": [ { "id": 2, "v": "two" } ]
+		}
+	}`)
+
+	sobj := []byte(`{ "items": [ { "id": 1, "v": "one" }, { "id": 2, "v": "2" } ] }`)
+
+	target, err := loadObject(tobj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := loadObject(sobj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target.SetMergeKeys("id")
+
+	if err := target.Overlay(source, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := target.GetArray("test", "items")
+	assert.Nil(err)
+
+	js, err := json.Marshal(v)
+	assert.Nil(err)
+
+	assert.JSONEq(`[ { "id": 1, "v": "one" }, { "id": 2, "v": "two" } ]`, string(js))
+}
@@ -15,6 +15,9 @@ type Macro struct {
 	EvalPhase  MacrosEvalPhase
 	VerbName   string
 	Argument   bool
+	// Splice is set for macros that replace their parent with
+	// any number of values, so the result cannot be type-checked
+	Splice bool
 }
 
 type UnregisteredModifier struct {
@@ -56,6 +59,9 @@ func (m *Modifier) Do(c *Converter) error {
 	if err := m.modifierCallback(m, c); err != nil {
 		return err
 	}
+	if m.Macro.Splice {
+		return nil
+	}
 	failFmt := "failed to type-check new value after macro evaluation"
 	vt, err := c.tree.Check(m.Branch.path[1 : len(m.Branch.path)-1]...)
 	if err != nil {
@@ -170,15 +176,65 @@ func (c *Converter) Set(branch *BranchLocator, value interface{}) error {
 	return nil
 }
 
+// SetMergeKeys overrides DefaultMergeKeys used by Overlay
+func (c *Converter) SetMergeKeys(keys ...string) { c.mergeKeys = keys }
+
 func (c *Converter) Overlay(branch *BranchLocator, value interface{}) error {
 	if err := c.Delete(branch); err != nil {
 		return err
 	}
+	if c.mergeKeys != nil {
+		c.tree.SetMergeKeys(c.mergeKeys...)
+	}
 	if err := c.tree.Overlay(NewTree(&value), branch.parent.path[1:]...); err != nil {
 		return fmt.Errorf("failed to overlay %v onto %v – %v", value, branch.parent.value, err)
 	}
 	return nil
 }
+
+// Splice replaces parent of the branch with the values, if parent is
+// an element of an array, values are inserted in its place, otherwise
+// parent becomes an array of values
+func (c *Converter) Splice(branch *BranchLocator, values []interface{}) error {
+	parentPath := branch.parent.path[1:]
+	if len(parentPath) == 0 {
+		return fmt.Errorf("cannot splice %v into the root object", values)
+	}
+
+	parent, err := c.tree.GetObject(parentPath...)
+	if err != nil {
+		return fmt.Errorf("failed to splice %v – %v", values, err)
+	}
+	if len(parent) > 1 {
+		return fmt.Errorf("failed to splice %v – %s must not have any keys other than %q",
+			values, branch.parent.PathToString(), branch.path[len(branch.path)-1])
+	}
+
+	index, ok := parentPath[len(parentPath)-1].(int)
+	if !ok {
+		if err := c.tree.Set(values, parentPath...); err != nil {
+			return fmt.Errorf("failed to splice %v – %v", values, err)
+		}
+		return nil
+	}
+
+	arrayPath := parentPath[:len(parentPath)-1]
+	x, err := c.tree.GetArray(arrayPath...)
+	if err != nil {
+		return fmt.Errorf("failed to splice %v – %v", values, err)
+	}
+
+	spliced := make([]interface{}, 0, len(x)-1+len(values))
+	spliced = append(spliced, x[:index]...)
+	spliced = append(spliced, values...)
+	spliced = append(spliced, x[index+1:]...)
+
+	if err := c.tree.Set(spliced, arrayPath...); err != nil {
+		return fmt.Errorf("failed to splice %v – %v", values, err)
+	}
+	return nil
+}
+
 func (c *Converter) Delete(branch *BranchLocator) error {
 	if err := c.tree.Delete(branch.path[1:]...); err != nil {
 		return fmt.Errorf("failed to delete %v – %v", branch.value, err)
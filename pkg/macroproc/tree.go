@@ -22,6 +22,8 @@ type Tree struct {
 	parent   *Tree
 	setValue func(newValue interface{})
 	delete   func()
+	// mergeKeys are only set on the root
+	mergeKeys []string
 }
 
 func loadObject(data []byte) (*Tree, error) {
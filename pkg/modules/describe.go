@@ -0,0 +1,215 @@
+package modules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/errordeveloper/kubegen/pkg/util"
+)
+
+type ModuleDescription struct {
+	SourceDir  string                 `json:"SourceDir"`
+	Parameters []AttributeDescription `json:"Parameters"`
+	Internals  []AttributeDescription `json:"Internals"`
+	Outputs    []AttributeDescription `json:"Outputs"`
+	Duplicates []string               `json:"Duplicates,omitempty"`
+}
+
+type AttributeDescription struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Required    bool        `json:"required"`
+	Default     interface{} `json:"default,omitempty"`
+	Value       interface{} `json:"value,omitempty"`
+	Sensitive   bool        `json:"sensitive,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Example     interface{} `json:"example,omitempty"`
+	DeclaredIn  string      `json:"declaredIn"`
+}
+
+// Describe lists parameters, internals and outputs declared in all of the manifests
+// in the module, and reports any that are declared more than once
+func (m *Module) Describe() *ModuleDescription {
+	d := &ModuleDescription{
+		SourceDir:  m.directory,
+		Parameters: []AttributeDescription{},
+		Internals:  []AttributeDescription{},
+		Outputs:    []AttributeDescription{},
+	}
+
+	declarations := make(map[string][]string)
+	declare := func(kind, name string, declaredIn ManifestPath) {
+		declarations[name] = append(declarations[name], fmt.Sprintf("%s in %q", kind, path.Base(declaredIn)))
+	}
+
+	for _, parameter := range m.Parameters {
+		declare("parameter", parameter.Name, parameter.declaredIn)
+		p := AttributeDescription{
+			Name:        parameter.Name,
+			Type:        parameter.Type,
+			Required:    parameter.Required,
+			Default:     parameter.Default,
+			Sensitive:   parameter.Sensitive,
+			Description: parameter.Description,
+			Example:     parameter.Example,
+			DeclaredIn:  path.Base(parameter.declaredIn),
+		}
+		if parameter.Sensitive && p.Default != nil {
+			p.Default = util.Redacted
+		}
+		d.Parameters = append(d.Parameters, p)
+	}
+
+	for _, internal := range m.Internals {
+		declare("internal", internal.Name, internal.declaredIn)
+		d.Internals = append(d.Internals, AttributeDescription{
+			Name:        internal.Name,
+			Type:        internal.Type,
+			Value:       internal.Value,
+			Description: internal.Description,
+			Example:     internal.Example,
+			DeclaredIn:  path.Base(internal.declaredIn),
+		})
+	}
+
+	for _, output := range m.Outputs {
+		d.Outputs = append(d.Outputs, AttributeDescription{
+			Name:        output.Name,
+			Value:       output.Value,
+			Description: output.Description,
+			DeclaredIn:  path.Base(output.declaredIn),
+		})
+	}
+
+	sort.Slice(d.Parameters, func(i, j int) bool { return d.Parameters[i].Name < d.Parameters[j].Name })
+	sort.Slice(d.Internals, func(i, j int) bool { return d.Internals[i].Name < d.Internals[j].Name })
+	sort.Slice(d.Outputs, func(i, j int) bool { return d.Outputs[i].Name < d.Outputs[j].Name })
+
+	names := []string{}
+	for name, declaredIn := range declarations {
+		if len(declaredIn) > 1 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		d.Duplicates = append(d.Duplicates, fmt.Sprintf("%q is declared more than once (as %s)",
+			name, strings.Join(declarations[name], ", ")))
+	}
+
+	return d
+}
+
+func (d *ModuleDescription) EncodeToJSON() ([]byte, error) {
+	// values are shown as they are, e.g. `<redacted>` shouldn't be escaped
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(d); err != nil {
+		return nil, fmt.Errorf("error encoding description of module %q – %v", d.SourceDir, err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *ModuleDescription) EncodeToTable() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := tabwriter.NewWriter(buf, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintf(w, "PARAMETER\tTYPE\tREQUIRED\tDEFAULT\tDESCRIPTION\n")
+	for _, p := range d.Parameters {
+		fmt.Fprintf(w, "%s\t%s\t%v\t%s\t%s\n", p.Name, p.Type, p.Required, truncateValue(formatValue(p.Default)), p.Description)
+	}
+	if len(d.Internals) > 0 {
+		fmt.Fprintf(w, "\nINTERNAL\tTYPE\t\tVALUE\tDESCRIPTION\n")
+		for _, i := range d.Internals {
+			fmt.Fprintf(w, "%s\t%s\t\t%s\t%s\n", i.Name, i.Type, truncateValue(formatValue(i.Value)), i.Description)
+		}
+	}
+	if len(d.Outputs) > 0 {
+		fmt.Fprintf(w, "\nOUTPUT\t\t\tVALUE\tDESCRIPTION\n")
+		for _, o := range d.Outputs {
+			fmt.Fprintf(w, "%s\t\t\t%s\t%s\n", o.Name, truncateValue(formatValue(o.Value)), o.Description)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *ModuleDescription) EncodeToMarkdown() ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "## Parameters\n\n")
+	fmt.Fprintf(buf, "| Name | Type | Required | Default | Description | Example |\n")
+	fmt.Fprintf(buf, "|------|------|----------|---------|-------------|---------|\n")
+	for _, p := range d.Parameters {
+		fmt.Fprintf(buf, "| `%s` | %s | %v | %s | %s | %s |\n",
+			p.Name, p.Type, p.Required, formatMarkdownValue(p.Default), escapeMarkdown(p.Description), formatMarkdownValue(p.Example))
+	}
+
+	if len(d.Internals) > 0 {
+		fmt.Fprintf(buf, "\n## Internals\n\n")
+		fmt.Fprintf(buf, "| Name | Type | Value | Description |\n")
+		fmt.Fprintf(buf, "|------|------|-------|-------------|\n")
+		for _, i := range d.Internals {
+			fmt.Fprintf(buf, "| `%s` | %s | %s | %s |\n",
+				i.Name, i.Type, formatMarkdownValue(i.Value), escapeMarkdown(i.Description))
+		}
+	}
+
+	if len(d.Outputs) > 0 {
+		fmt.Fprintf(buf, "\n## Outputs\n\n")
+		fmt.Fprintf(buf, "| Name | Value | Description |\n")
+		fmt.Fprintf(buf, "|------|-------|-------------|\n")
+		for _, o := range d.Outputs {
+			fmt.Fprintf(buf, "| `%s` | %s | %s |\n",
+				o.Name, formatMarkdownValue(o.Value), escapeMarkdown(o.Description))
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func formatValue(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "-"
+	case string, float64, int, bool:
+		return fmt.Sprintf("%v", v)
+	default:
+		// objects and arrays are rather long, so we show them in JSON
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(data)
+	}
+}
+
+// truncateValue keeps the table readable, full values can be obtained in JSON
+func truncateValue(s string) string {
+	const maxLength = 40
+	if len(s) > maxLength {
+		return s[:maxLength-3] + "..."
+	}
+	return s
+}
+
+func formatMarkdownValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return "`" + escapeMarkdown(formatValue(v)) + "`"
+}
+
+func escapeMarkdown(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+}
@@ -0,0 +1,75 @@
+package modules
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribe(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"params.yml": `
+Kind: kubegen.k8s.io/Module.v1alpha2
+Parameters:
+- name: replicas
+  type: Number
+  default: 2
+  description: Number of replicas
+- name: token
+  type: String
+  default: hunter2
+  sensitive: true
+  example: abc123
+- name: name
+  type: String
+  required: true
+`,
+		"app.yml": `
+Kind: kubegen.k8s.io/Module.v1alpha2
+Internals:
+- name: replicas
+  type: Number
+  value: 3
+Outputs:
+- name: url
+  value: http://app
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	m, err := NewModule(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := m.Describe()
+
+	parameters := []AttributeDescription{
+		{Name: "name", Type: "String", Required: true, DeclaredIn: "params.yml"},
+		{Name: "replicas", Type: "Number", Default: 2.0, Description: "Number of replicas", DeclaredIn: "params.yml"},
+		{Name: "token", Type: "String", Default: "<redacted>", Sensitive: true, Example: "abc123", DeclaredIn: "params.yml"},
+	}
+	assert.Equal(t, parameters, d.Parameters)
+	assert.Equal(t, []AttributeDescription{{Name: "replicas", Type: "Number", Value: 3.0, DeclaredIn: "app.yml"}}, d.Internals)
+	assert.Equal(t, []AttributeDescription{{Name: "url", Value: "http://app", DeclaredIn: "app.yml"}}, d.Outputs)
+	assert.Equal(t, []string{`"replicas" is declared more than once (as parameter in "params.yml", internal in "app.yml")`}, d.Duplicates)
+
+	tests := []struct {
+		encode   func() ([]byte, error)
+		contains []string
+	}{
+		{d.EncodeToTable, []string{"replicas   Number  false     2", "token      String  false     <redacted>"}},
+		{d.EncodeToJSON, []string{`"default": "<redacted>"`, `"declaredIn": "params.yml"`}},
+		{d.EncodeToMarkdown, []string{"| `replicas` | Number | false | `2` | Number of replicas |  |"}},
+	}
+	for n, test := range tests {
+		data, err := test.encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range test.contains {
+			assert.Contains(t, string(data), s, n)
+		}
+		assert.NotContains(t, string(data), "hunter2", n)
+	}
+}
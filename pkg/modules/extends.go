@@ -0,0 +1,199 @@
+package modules
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/errordeveloper/kubegen/pkg/util"
+)
+
+// resolveExtends loads the chain of base bundles and merges this bundle on top of it,
+// extendedBy holds paths of the bundles that were loaded before, to detect any cycles
+func (b *Bundle) resolveExtends(extendedBy []string) error {
+	basePath := b.Extends
+	if !path.IsAbs(basePath) {
+		basePath = path.Join(path.Dir(b.path), basePath)
+	}
+
+	chain := append(append([]string{}, extendedBy...), b.path)
+	for _, p := range chain {
+		if sameFile(p, basePath) {
+			return fmt.Errorf(
+				"error loading bundle manifest %q – cyclic `Extends` [%s]",
+				b.path, strings.Join(append(chain, basePath), " → "))
+		}
+	}
+
+	base, err := newBundle(basePath, chain)
+	if err != nil {
+		return err
+	}
+
+	return b.mergeOnto(base)
+}
+
+// Encode returns the bundle manifest, which is useful to see the result of `Extends`
+func (b *Bundle) Encode(contentType string) ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+	switch contentType {
+	case "yaml":
+		data, err = yaml.Marshal(b)
+	case "json":
+		data, err = json.MarshalIndent(b, "", "  ")
+		data = append(data, '\n')
+	default:
+		return nil, fmt.Errorf("unknown content type %q", contentType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error encoding bundle manifest %q – %v", b.path, err)
+	}
+	return data, nil
+}
+
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return path.Clean(a) == path.Clean(b)
+	}
+	return absA == absB
+}
+
+func (b *Bundle) mergeOnto(base *Bundle) error {
+	if b.Name == "" {
+		b.Name = base.Name
+	}
+	if b.Namespace == "" {
+		b.Namespace = base.Namespace
+	}
+	if b.Description == "" {
+		b.Description = base.Description
+	}
+	b.Parameters = mergeValues(base.Parameters, b.Parameters)
+	b.CommonLabels = util.MergeStringMaps(base.CommonLabels, b.CommonLabels)
+	b.CommonAnnotations = util.MergeStringMaps(base.CommonAnnotations, b.CommonAnnotations)
+	b.CommonLabelsInSelectors = b.CommonLabelsInSelectors || base.CommonLabelsInSelectors
+	b.Images = mergeImageOverrides(base.Images, b.Images)
+
+	overrides := make(map[string]*ModuleInstance, len(b.Modules))
+	for n, i := range b.Modules {
+		if _, ok := overrides[i.Name]; ok {
+			return fmt.Errorf(
+				"error loading bundle manifest %q – module %q is defined more than once, it cannot be used with `Extends`",
+				b.path, i.Name)
+		}
+		overrides[i.Name] = &b.Modules[n]
+	}
+
+	defined := make(map[string]int, len(base.Modules))
+	for _, i := range base.Modules {
+		defined[i.Name]++
+	}
+
+	modules := []ModuleInstance{}
+	for _, i := range base.Modules {
+		// paths in the base bundle are relative to it, so it can reside in another directory
+		i.SourceDir = rebasePath(i.SourceDir, path.Dir(base.path), path.Dir(b.path))
+
+		override, ok := overrides[i.Name]
+		if !ok {
+			modules = append(modules, i)
+			continue
+		}
+		if defined[i.Name] > 1 {
+			return fmt.Errorf(
+				"error loading bundle manifest %q – module %q is defined more than once in %q, so it cannot be overridden",
+				b.path, i.Name, base.path)
+		}
+		delete(overrides, i.Name)
+		if override.Remove {
+			continue
+		}
+		modules = append(modules, override.mergeOnto(i))
+	}
+
+	// any modules that are not in the base bundle get added in the order they are defined
+	for _, i := range b.Modules {
+		if _, ok := overrides[i.Name]; !ok {
+			continue
+		}
+		if i.Remove {
+			return fmt.Errorf(
+				"error loading bundle manifest %q – cannot remove module %q, as it's not defined in %q",
+				b.path, i.Name, base.path)
+		}
+		modules = append(modules, i)
+	}
+
+	b.Modules = modules
+	b.Extends = ""
+
+	return nil
+}
+
+func (i ModuleInstance) mergeOnto(base ModuleInstance) ModuleInstance {
+	if i.Namespace == "" {
+		i.Namespace = base.Namespace
+	}
+	// the source can be changed to either kind, so setting one of them clears the other
+	if i.SourceDir == "" && i.Source == "" {
+		i.SourceDir = base.SourceDir
+		i.Source = base.Source
+	}
+	if i.OutputDir == "" {
+		i.OutputDir = base.OutputDir
+	}
+	if i.NamePrefix == "" {
+		i.NamePrefix = base.NamePrefix
+	}
+	if i.NameSuffix == "" {
+		i.NameSuffix = base.NameSuffix
+	}
+	i.Parameters = mergeValues(base.Parameters, i.Parameters)
+	i.Internals = mergeValues(base.Internals, i.Internals)
+	i.CommonLabels = util.MergeStringMaps(base.CommonLabels, i.CommonLabels)
+	i.CommonAnnotations = util.MergeStringMaps(base.CommonAnnotations, i.CommonAnnotations)
+	i.CommonLabelsInSelectors = i.CommonLabelsInSelectors || base.CommonLabelsInSelectors
+	i.Images = mergeImageOverrides(base.Images, i.Images)
+	return i
+}
+
+// mergeValues merges nested objects, while any other values in override replace those in base
+func mergeValues(base, override map[string]interface{}) map[string]interface{} {
+	if base == nil && override == nil {
+		return nil
+	}
+	result := make(map[string]interface{}, len(base)+len(override))
+	for k, v := range base {
+		result[k] = v
+	}
+	for k, v := range override {
+		baseObj, baseIsObj := result[k].(map[string]interface{})
+		obj, isObj := v.(map[string]interface{})
+		if baseIsObj && isObj {
+			result[k] = mergeValues(baseObj, obj)
+			continue
+		}
+		result[k] = v
+	}
+	return result
+}
+
+func rebasePath(p, from, to string) string {
+	if p == "" || path.IsAbs(p) || from == to {
+		return p
+	}
+	rel, err := filepath.Rel(to, path.Join(from, p))
+	if err != nil {
+		return path.Join(from, p)
+	}
+	return rel
+}
@@ -0,0 +1,102 @@
+package modules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtends(t *testing.T) {
+	base := `
+Kind: kubegen.k8s.io/Bundle.v1alpha2
+Namespace: shop
+Parameters:
+  domain: example.com
+Modules:
+- Name: prod
+  SourceDir: modules/app
+  Namespace: prod
+  Parameters:
+    image: app:1
+- Name: test
+  SourceDir: modules/app
+`
+
+	tests := []struct {
+		bundle  string
+		modules string
+		err     string
+	}{
+		{
+			"Modules:\n- Name: prod\n  Parameters:\n    domain: prod.example.com",
+			"prod:prod:modules/app:map[domain:prod.example.com image:app:1] test::modules/app:map[]",
+			"",
+		},
+		{
+			"Modules:\n- Name: test\n  Remove: true\n- Name: staging\n  SourceDir: ../modules/app\n  Namespace: staging",
+			"prod:prod:modules/app:map[image:app:1] staging:staging:modules/app:map[]",
+			"",
+		},
+		{
+			"Modules:\n- Name: dev\n  Remove: true",
+			"",
+			`cannot remove module "dev", as it's not defined in`,
+		},
+		{
+			"Modules:\n- Name: prod\n- Name: prod",
+			"",
+			`module "prod" is defined more than once, it cannot be used with` + " `Extends`",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.bundle, func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{
+				"base.yml":        base,
+				"envs/bundle.yml": "Kind: kubegen.k8s.io/Bundle.v1alpha2\nExtends: ../base.yml\n" + test.bundle,
+			})
+			defer os.RemoveAll(dir)
+
+			bundle, err := NewBundle(filepath.Join(dir, "envs/bundle.yml"))
+			if test.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			modules := []string{}
+			for _, i := range bundle.Modules {
+				sourceDir, err := filepath.Rel(dir, filepath.Join(filepath.Dir(bundle.path), i.SourceDir))
+				if err != nil {
+					t.Fatal(err)
+				}
+				modules = append(modules, fmt.Sprintf("%s:%s:%s:%v", i.Name, i.Namespace, sourceDir, i.Parameters))
+			}
+			assert.Equal(t, test.modules, strings.Join(modules, " "))
+			assert.Equal(t, "shop", bundle.Namespace)
+			assert.Equal(t, map[string]interface{}{"domain": "example.com"}, bundle.Parameters)
+			assert.Empty(t, bundle.Extends)
+		})
+	}
+}
+
+func TestExtendsCycle(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.yml": "Kind: kubegen.k8s.io/Bundle.v1alpha2\nExtends: b.yml\n",
+		"b.yml": "Kind: kubegen.k8s.io/Bundle.v1alpha2\nExtends: a.yml\n",
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := NewBundle(filepath.Join(dir, "a.yml"))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cyclic `Extends`")
+	}
+}
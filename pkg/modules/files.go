@@ -0,0 +1,255 @@
+package modules
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/errordeveloper/kubegen/pkg/util"
+)
+
+const (
+	ModuleIndexKind = "kubegen.k8s.io/ModuleIndex.v1alpha2"
+	IgnoreFileName  = ".kubegenignore"
+)
+
+// ModuleIndexFileNames are the names a module index can have, only one of them may exist
+var ModuleIndexFileNames = []string{"kubegen-module.yml", "kubegen-module.yaml", "kubegen-module.json", "kubegen-module.hcl"}
+
+// manifestExtensions are the formats supported by util.LoadObj, files with
+// other extensions are always skipped, even if the module index includes them
+var manifestExtensions = []string{".yml", ".yaml", ".json", ".hcl", ".kg"}
+
+// ModuleIndex can be used to select which files in the module are its manifests
+type ModuleIndex struct {
+	Kind    string   `yaml:"Kind" json:"Kind" hcl:"kind"`
+	Include []string `yaml:"Include,omitempty" json:"Include,omitempty" hcl:"include"`
+	Exclude []string `yaml:"Exclude,omitempty" json:"Exclude,omitempty" hcl:"exclude"`
+}
+
+type ignorePattern struct {
+	pattern string
+	negate  bool
+}
+
+// validatePattern checks each of the path elements, as path.Match
+// would only report a bad pattern when it's matched against a name
+func validatePattern(pattern string) error {
+	for _, elem := range strings.Split(pattern, "/") {
+		if _, err := path.Match(elem, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q – %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchPattern matches a glob pattern against a slash-separated path, a pattern without
+// any slashes matches any of the path elements, while "**" matches any number of them,
+// and a pattern that matches a directory also matches everything in it
+func matchPattern(pattern, name string) bool {
+	pattern = strings.TrimSuffix(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		for _, elem := range strings.Split(name, "/") {
+			if ok, _ := path.Match(pattern, elem); ok {
+				return true
+			}
+		}
+		return false
+	}
+	return matchPathElements(strings.Split(strings.TrimPrefix(pattern, "/"), "/"), strings.Split(name, "/"))
+}
+
+func matchPathElements(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for n := 0; n <= len(name); n++ {
+				if matchPathElements(pattern[1:], name[n:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return true
+}
+
+func matchAnyPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func loadModuleIndex(dir string) (*ModuleIndex, string, error) {
+	var (
+		index     *ModuleIndex
+		indexPath string
+	)
+
+	for _, name := range ModuleIndexFileNames {
+		p := path.Join(dir, name)
+		data, err := ioutil.ReadFile(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("error reading module index %q – %v", p, err)
+		}
+		if index != nil {
+			return nil, "", fmt.Errorf("module %q must have only one index, found %q and %q", dir, indexPath, p)
+		}
+		index, indexPath = &ModuleIndex{}, p
+		if err := util.LoadObj(index, data, p, ""); err != nil {
+			return nil, "", err
+		}
+		if index.Kind != ModuleIndexKind {
+			return nil, "", fmt.Errorf(
+				"error loading module index %q – unrecognised `Kind: %q`, must be %q",
+				p, index.Kind, ModuleIndexKind)
+		}
+		for _, pattern := range append(index.Include, index.Exclude...) {
+			if err := validatePattern(pattern); err != nil {
+				return nil, "", fmt.Errorf("error loading module index %q – %v", p, err)
+			}
+		}
+	}
+
+	return index, indexPath, nil
+}
+
+func loadIgnoreFile(dir string) ([]ignorePattern, error) {
+	p := path.Join(dir, IgnoreFileName)
+	data, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %q – %v", p, err)
+	}
+
+	patterns := []ignorePattern{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		negate := strings.HasPrefix(line, "!")
+		line = strings.TrimPrefix(line, "!")
+		if err := validatePattern(line); err != nil {
+			return nil, fmt.Errorf("error loading %q – %v", p, err)
+		}
+		patterns = append(patterns, ignorePattern{pattern: line, negate: negate})
+	}
+
+	return patterns, scanner.Err()
+}
+
+// isIgnored applies patterns in order, so the last matching one wins
+func isIgnored(patterns []ignorePattern, name string) bool {
+	ignored := false
+	for _, p := range patterns {
+		if matchPattern(p.pattern, name) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+func hasManifestExtension(name string) bool {
+	for _, ext := range manifestExtensions {
+		if path.Ext(name) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// findManifests walks the module directory and returns paths of the manifests, hidden files
+// and directories are always skipped, as well as the tests directory and anything that is
+// ignored or excluded
+func findManifests(dir string) ([]ManifestPath, error) {
+	index, indexPath, err := loadModuleIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ignorePatterns, err := loadIgnoreFile(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestPaths := []ManifestPath{}
+	walkFn := func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if strings.HasPrefix(info.Name(), ".") || isIgnored(ignorePatterns, rel) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() && rel == TestsDirName {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || p == indexPath {
+			return nil
+		}
+
+		if !hasManifestExtension(rel) {
+			return nil
+		}
+		if index != nil {
+			if len(index.Include) > 0 && !matchAnyPattern(index.Include, rel) {
+				return nil
+			}
+			if matchAnyPattern(index.Exclude, rel) {
+				return nil
+			}
+		}
+
+		manifestPaths = append(manifestPaths, path.Join(dir, rel))
+		return nil
+	}
+
+	if err := filepath.Walk(dir, walkFn); err != nil {
+		return nil, fmt.Errorf("error reading module %q – %v", dir, err)
+	}
+
+	sort.Strings(manifestPaths)
+	return manifestPaths, nil
+}
+
+// relativePath returns path of the manifest within the module directory
+func (m *Module) relativePath(manifestPath ManifestPath) string {
+	rel, err := filepath.Rel(m.directory, manifestPath)
+	if err != nil {
+		return path.Base(manifestPath)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,117 @@
+package modules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModuleFiles(t *testing.T) {
+	manifest := func(name string) string {
+		return fmt.Sprintf("Kind: kubegen.k8s.io/Module.v1alpha2\nServices:\n- name: %s\n  port: 80\n", name)
+	}
+
+	tests := []struct {
+		files   map[string]string
+		written []string
+		err     string
+	}{
+		{
+			map[string]string{
+				"web.yml":           manifest("web"),
+				"db/mongo.yml":      manifest("mongo"),
+				"db/.mongo.yml.swp": "binary",
+				".hidden/x.yml":     manifest("x"),
+				"README.md":         "# App",
+				"tests/tests.yml":   "Kind: kubegen.k8s.io/ModuleTests.v1alpha2",
+			},
+			[]string{"db/mongo.yaml", "web.yaml"},
+			"",
+		},
+		{
+			map[string]string{
+				"web.yml":        manifest("web"),
+				"db/mongo.yml":   manifest("mongo"),
+				"db/redis.yml":   manifest("redis"),
+				"drafts/new.yml": "not a manifest yet",
+				".kubegenignore": "# drafts aren't ready\ndrafts/\ndb/*.yml\n!db/mongo.yml\n",
+			},
+			[]string{"db/mongo.yaml", "web.yaml"},
+			"",
+		},
+		{
+			map[string]string{
+				"kubegen-module.yml":  "Kind: kubegen.k8s.io/ModuleIndex.v1alpha2\nInclude: [/web.yml, 'db/**']\nExclude: ['**/*-values.yml']\n",
+				"web.yml":             manifest("web"),
+				"old/web.yml":         manifest("web"),
+				"db/mongo.yml":        manifest("mongo"),
+				"db/README.md":        "# Databases",
+				"db/mongo-values.yml": "replicas: 1",
+			},
+			[]string{"db/mongo.yaml", "web.yaml"},
+			"",
+		},
+		{
+			map[string]string{
+				"kubegen-module.yml":  "Kind: kubegen.k8s.io/ModuleIndex.v1alpha2\n",
+				"kubegen-module.json": `{"Kind": "kubegen.k8s.io/ModuleIndex.v1alpha2"}`,
+			},
+			nil,
+			"must have only one index",
+		},
+		{
+			map[string]string{
+				"kubegen-module.yml": "Kind: kubegen.k8s.io/ModuleIndex.v1alpha2\nInclude: ['[a-']\n",
+			},
+			nil,
+			`invalid pattern "[a-"`,
+		},
+		{
+			map[string]string{
+				"web.yml":        manifest("web"),
+				".kubegenignore": "db/[\n",
+			},
+			nil,
+			`invalid pattern "db/["`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.err, func(t *testing.T) {
+			files := map[string]string{}
+			for k, v := range test.files {
+				files["app/"+k] = v
+			}
+			dir := writeFiles(t, files)
+			defer os.RemoveAll(dir)
+
+			bundle, err := loadBundle(ModuleInstance{
+				Name:      "app",
+				SourceDir: filepath.Join(dir, "app"),
+				OutputDir: filepath.Join(dir, "out"),
+			})
+			if test.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			written, err := bundle.WriteToOutputDir("yaml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for n := range written {
+				written[n] = filepath.ToSlash(strings.TrimPrefix(written[n], filepath.Join(dir, "out")+"/"))
+			}
+			assert.Equal(t, test.written, written)
+		})
+	}
+}
@@ -0,0 +1,531 @@
+package modules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/errordeveloper/kubegen/pkg/macroproc"
+	"github.com/errordeveloper/kubegen/pkg/util"
+)
+
+const (
+	HelmChartAPIVersion = "v2"
+	// HelmChartVersion is the version charts get, unless another one is given
+	HelmChartVersion = "0.1.0"
+)
+
+// helmMacros are the only macros that can be expressed in Helm templates, as values of parameters
+// are either used as they are or joined with other strings, anything else would transform them
+var helmMacros = map[string]bool{
+	macroproc.MacroStringLookup.String(): true,
+	macroproc.MacroNumberLookup.String(): true,
+	macroproc.MacroObjectLookup.String(): true,
+	macroproc.MacroArrayLookup.String():  true,
+	macroproc.MacroStringJoin.String():   true,
+}
+
+// HelmChartMetadata is what gets written to Chart.yaml
+type HelmChartMetadata struct {
+	APIVersion  string `yaml:"apiVersion" json:"apiVersion"`
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	Type        string `yaml:"type" json:"type"`
+	Version     string `yaml:"version" json:"version"`
+}
+
+// HelmChart holds contents of the files of a chart, keyed by paths relative to the chart directory
+type HelmChart struct {
+	Metadata HelmChartMetadata
+	Files    map[string][]byte
+}
+
+var helmIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ExportHelmChart generates a chart from the module in dir, values.yaml is made of defaults of the
+// parameters, and templates are the resources the module generates, where values that stand for
+// parameters are replaced by references to the values, so only lookups and joins are supported
+func ExportHelmChart(dir, name, version string) (*HelmChart, error) {
+	m, err := NewModule(dir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(m.Modules) > 0 {
+		return nil, fmt.Errorf("cannot export module %q as a Helm chart – sub-modules are not supported", dir)
+	}
+
+	m.instance = ModuleInstance{Name: name, SourceDir: dir}
+	if err := m.checkHelmMacros(); err != nil {
+		return nil, err
+	}
+
+	// the module is rendered twice with different placeholders, so that values that stand for parameters
+	// can be told apart from anything else, as only these differ between the two sets of objects
+	placeholders, otherPlaceholders := make(map[string]interface{}), make(map[string]interface{})
+	for n, p := range m.Parameters {
+		if placeholders[p.Name], err = helmPlaceholder(p, n, 0); err != nil {
+			return nil, fmt.Errorf("cannot export module %q as a Helm chart – %v", dir, err)
+		}
+		otherPlaceholders[p.Name], _ = helmPlaceholder(p, n, 1)
+	}
+
+	objs, err := renderHelmObjects(dir, name, placeholders)
+	if err != nil {
+		return nil, helmRenderError(dir, name, m.Parameters, placeholders, err)
+	}
+	otherObjs, err := renderHelmObjects(dir, name, otherPlaceholders)
+	if err != nil {
+		return nil, helmRenderError(dir, name, m.Parameters, otherPlaceholders, err)
+	}
+
+	t := &helmTemplater{
+		parameters:        m.Parameters,
+		placeholders:      placeholders,
+		otherPlaceholders: otherPlaceholders,
+	}
+
+	chart := &HelmChart{
+		Metadata: HelmChartMetadata{
+			APIVersion:  HelmChartAPIVersion,
+			Name:        name,
+			Description: fmt.Sprintf("Generated by kubegen from module %q", path.Base(dir)),
+			Type:        "application",
+			Version:     version,
+		},
+		Files: make(map[string][]byte, len(objs)+2),
+	}
+
+	mismatched := []string{}
+	for manifestPath, items := range objs {
+		relativePath := m.relativePath(manifestPath)
+		filename := path.Join("templates", strings.TrimSuffix(relativePath, path.Ext(relativePath))+".yaml")
+
+		template, ok := t.template(items, otherObjs[manifestPath])
+		if !ok {
+			mismatched = append(mismatched, filename)
+			continue
+		}
+		if chart.Files[filename], err = t.encode(template, relativePath); err != nil {
+			return nil, err
+		}
+	}
+	if len(mismatched) > 0 {
+		sort.Strings(mismatched)
+		return nil, fmt.Errorf(
+			"cannot export module %q as a Helm chart – values of parameters are transformed in a way that cannot be expressed in templates %q (e.g. as data of a Secret)",
+			dir, mismatched)
+	}
+
+	if chart.Files["Chart.yaml"], err = yaml.Marshal(chart.Metadata); err != nil {
+		return nil, err
+	}
+
+	if chart.Files["values.yaml"], err = helmValues(m.Parameters); err != nil {
+		return nil, err
+	}
+
+	return chart, nil
+}
+
+// checkHelmMacros reports all of the macros that cannot be expressed in templates at once, outputs are not
+// checked, as these are only used by bundles
+func (m *Module) checkHelmMacros() error {
+	unsupported := []string{}
+
+	check := func(manifestPath ManifestPath, data []byte, skipKeys ...string) error {
+		var obj interface{}
+		if err := util.LoadObj(&obj, data, manifestPath, m.instance.Name); err != nil {
+			return err
+		}
+		if x, ok := obj.(map[string]interface{}); ok {
+			for _, k := range skipKeys {
+				delete(x, k)
+			}
+		}
+		for _, macro := range findUnsupportedHelmMacros(obj, "") {
+			unsupported = append(unsupported, fmt.Sprintf("%s in %q", macro, m.relativePath(manifestPath)))
+		}
+		return nil
+	}
+
+	manifestPaths := []string{}
+	for manifestPath := range m.manifests {
+		manifestPaths = append(manifestPaths, manifestPath)
+	}
+	sort.Strings(manifestPaths)
+
+	for _, manifestPath := range manifestPaths {
+		if err := check(manifestPath, m.manifests[manifestPath], "Outputs"); err != nil {
+			return err
+		}
+	}
+
+	for _, resource := range m.Resources {
+		manifestPath := path.Join(m.directory, resource.Path)
+		data, err := ioutil.ReadFile(manifestPath)
+		if err != nil {
+			return fmt.Errorf("error reading file %q in module %q – %v", resource.Path, m.directory, err)
+		}
+		if err := check(manifestPath, data); err != nil {
+			return err
+		}
+	}
+
+	if len(unsupported) > 0 {
+		return fmt.Errorf(
+			"cannot export module %q as a Helm chart – only lookups and joins can be expressed in templates, found:\n  – %s",
+			m.directory, strings.Join(unsupported, "\n  – "))
+	}
+	return nil
+}
+
+func findUnsupportedHelmMacros(v interface{}, stringPath string) []string {
+	found := []string{}
+	switch x := v.(type) {
+	case map[string]interface{}:
+		keys := []string{}
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if strings.HasPrefix(k, "kubegen.") && !helmMacros[k] {
+				found = append(found, fmt.Sprintf("%s at %s", k, stringPath))
+				continue
+			}
+			found = append(found, findUnsupportedHelmMacros(x[k], stringPath+fmt.Sprintf("[%q]", k))...)
+		}
+	case []interface{}:
+		for n, e := range x {
+			found = append(found, findUnsupportedHelmMacros(e, stringPath+fmt.Sprintf("[%d]", n))...)
+		}
+	}
+	return found
+}
+
+// helmPlaceholder is what the value of a parameter is set to while the module is being rendered, strings
+// are valid base64 of a length that is a multiple of 4, so that these are kept as they are in data of Secrets
+// (which must be set in base64)
+func helmPlaceholder(p ModuleParameter, n, variant int) (interface{}, error) {
+	switch p.Type {
+	case "String":
+		return fmt.Sprintf("%s%dx%06d", helmPlaceholderPrefix, variant, n), nil
+	case "Number":
+		return int32(2000000000 + variant*100000 + n), nil
+	case "Array":
+		return nil, fmt.Errorf("parameter %q is of type \"Array\", which cannot be exported to Helm", p.Name)
+	default:
+		return nil, fmt.Errorf("parameter %q of unknown type %q, only types \"String\" and \"Number\" are supported", p.Name, p.Type)
+	}
+}
+
+const (
+	helmPlaceholderPrefix = "kubegenHelmValue"
+	// actions are written as tokens first, which get replaced once the templates are encoded
+	helmActionPrefix = "kubegenHelmAction"
+)
+
+// helmValueExpr refers to the value of the parameter, and makes sure it is set when there is no default
+func helmValueExpr(p ModuleParameter) string {
+	ref := ".Values." + p.Name
+	if !helmIdentifier.MatchString(p.Name) {
+		ref = fmt.Sprintf("(index .Values %q)", p.Name)
+	}
+	if p.Required || p.Default == nil {
+		return fmt.Sprintf("required %q %s", fmt.Sprintf("value %q must be set", p.Name), ref)
+	}
+	return ref
+}
+
+// renderHelmObjects generates resources of the module with the given values of the parameters, a new instance
+// of the module is needed each time, as resources get accumulated
+func renderHelmObjects(dir, name string, values map[string]interface{}) (map[ManifestPath][]object, error) {
+	m, err := NewModule(dir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	instance := ModuleInstance{Name: name, SourceDir: dir}
+	m.instance = instance
+	m.attributes = make(map[AttributeKey]attribute, len(m.Parameters))
+
+	for _, p := range m.Parameters {
+		if _, ok := m.attributes[p.Name]; ok {
+			return nil, fmt.Errorf("cannot declare parameter %q in module %q, already defined", p.Name, name)
+		}
+		m.attributes[p.Name] = attribute{
+			Type:  p.Type,
+			Value: values[p.Name],
+			Kind:  "parameter",
+		}
+	}
+
+	internals, err := sortInternals(m.Internals, name)
+	if err != nil {
+		return nil, err
+	}
+	for _, internal := range internals {
+		if err := internal.load(m, instance); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := m.IncludeResouces(instance); err != nil {
+		return nil, err
+	}
+
+	lists, err := m.makeLists(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	// objects are cleaned up in the same way as when these are written out
+	objs := make(map[ManifestPath][]object, len(lists))
+	for manifestPath, list := range lists {
+		for _, item := range list.Items {
+			data, err := util.Encode(item.Object, "application/json", false)
+			if err != nil {
+				return nil, err
+			}
+			obj := make(object)
+			if err := json.Unmarshal(data, &obj); err != nil {
+				return nil, err
+			}
+			objs[manifestPath] = append(objs[manifestPath], obj)
+		}
+	}
+	return objs, nil
+}
+
+// helmRenderError tells which of the parameters the module cannot be rendered with placeholders for, these
+// are used where a value of a particular format is expected (e.g. a quantity of CPU), which means that the
+// field is not a string in the resource, so it cannot be set from a template, each of the parameters is
+// tried on its own with the others set to their defaults
+func helmRenderError(dir, name string, parameters []ModuleParameter, placeholders map[string]interface{}, err error) error {
+	defaults := make(map[string]interface{}, len(parameters))
+	for _, p := range parameters {
+		defaults[p.Name] = placeholders[p.Name]
+		if p.Default != nil {
+			defaults[p.Name] = p.Default
+		}
+	}
+	if _, defaultsErr := renderHelmObjects(dir, name, defaults); defaultsErr != nil {
+		return fmt.Errorf("cannot export module %q as a Helm chart – %v", dir, err)
+	}
+
+	unsupported := []string{}
+	for _, p := range parameters {
+		if p.Default == nil {
+			continue
+		}
+		values := make(map[string]interface{}, len(defaults))
+		for k, v := range defaults {
+			values[k] = v
+		}
+		values[p.Name] = placeholders[p.Name]
+		if _, err := renderHelmObjects(dir, name, values); err != nil {
+			unsupported = append(unsupported, p.Name)
+		}
+	}
+	if len(unsupported) == 0 {
+		return fmt.Errorf("cannot export module %q as a Helm chart – %v", dir, err)
+	}
+	return fmt.Errorf(
+		"cannot export module %q as a Helm chart – parameters %q are used in fields that only accept values of a particular format (e.g. quantities), which cannot be set from templates",
+		dir, unsupported)
+}
+
+// helmTemplater turns objects rendered with placeholders into templates
+type helmTemplater struct {
+	parameters                      []ModuleParameter
+	placeholders, otherPlaceholders map[string]interface{}
+	// actions are indexed by the number in the token
+	actions []string
+}
+
+func (t *helmTemplater) action(expr string) string {
+	t.actions = append(t.actions, "{{ "+expr+" }}")
+	return fmt.Sprintf("%s%06d", helmActionPrefix, len(t.actions)-1)
+}
+
+// template compares objects rendered with two sets of placeholders, anything that is the same is kept as it is,
+// while values that differ become actions, it returns false if any of the values differ in any other way, which
+// means that the value of a parameter got transformed
+func (t *helmTemplater) template(objs, otherObjs []object) (interface{}, bool) {
+	items := make([]interface{}, len(objs))
+	for n := range objs {
+		items[n] = objs[n]
+	}
+	otherItems := make([]interface{}, len(otherObjs))
+	for n := range otherObjs {
+		otherItems[n] = otherObjs[n]
+	}
+	return t.templateValue(items, otherItems)
+}
+
+func (t *helmTemplater) templateValue(v, other interface{}) (interface{}, bool) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		y, ok := other.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return nil, false
+		}
+		result := make(map[string]interface{}, len(x))
+		for k := range x {
+			if _, ok := y[k]; !ok {
+				return nil, false
+			}
+			if result[k], ok = t.templateValue(x[k], y[k]); !ok {
+				return nil, false
+			}
+		}
+		return result, true
+	case []interface{}:
+		y, ok := other.([]interface{})
+		if !ok || len(x) != len(y) {
+			return nil, false
+		}
+		result := make([]interface{}, len(x))
+		for n := range x {
+			if result[n], ok = t.templateValue(x[n], y[n]); !ok {
+				return nil, false
+			}
+		}
+		return result, true
+	case string:
+		y, ok := other.(string)
+		if !ok {
+			return nil, false
+		}
+		return t.templateString(x, y)
+	case float64:
+		if y, ok := other.(float64); ok && x == y {
+			return x, true
+		}
+		// a number that differs can only be the value of a parameter
+		for _, p := range t.parameters {
+			if p.Type != "Number" {
+				continue
+			}
+			if float64(t.placeholders[p.Name].(int32)) == x && float64(t.otherPlaceholders[p.Name].(int32)) == other {
+				return t.action(helmValueExpr(p)), true
+			}
+		}
+		return nil, false
+	default:
+		return v, v == other
+	}
+}
+
+// templateString turns placeholders in a string into actions, a string that is made of a placeholder
+// alone is quoted, so that values such as "true" or "1" remain strings
+func (t *helmTemplater) templateString(s, other string) (interface{}, bool) {
+	if s == other {
+		return s, true
+	}
+
+	for _, p := range t.parameters {
+		if s == fmt.Sprintf("%v", t.placeholders[p.Name]) && other == fmt.Sprintf("%v", t.otherPlaceholders[p.Name]) {
+			return t.action(helmValueExpr(p) + " | quote"), true
+		}
+	}
+
+	// the placeholders are of the same length in both sets, so the rest of the strings has to be the same
+	for _, p := range t.parameters {
+		placeholder := fmt.Sprintf("%v", t.placeholders[p.Name])
+		otherPlaceholder := fmt.Sprintf("%v", t.otherPlaceholders[p.Name])
+		if !strings.Contains(s, placeholder) {
+			continue
+		}
+		action := t.action(helmValueExpr(p))
+		s = strings.Replace(s, placeholder, action, -1)
+		other = strings.Replace(other, otherPlaceholder, action, -1)
+	}
+	return s, s == other
+}
+
+// encode writes the objects as YAML documents, and replaces tokens with actions
+func (t *helmTemplater) encode(template interface{}, relativePath string) ([]byte, error) {
+	buf := bytes.NewBufferString(fmt.Sprintf("# Generated by kubegen from %q\n", relativePath))
+	for n, obj := range template.([]interface{}) {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding template of %q – %v", relativePath, err)
+		}
+		if n > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.Write(data)
+	}
+
+	// anything that looks like an action has to be escaped, so that it's kept as it is
+	data := bytes.Replace(buf.Bytes(), []byte("{{"), []byte(`{{ "{{" }}`), -1)
+	return helmActionToken.ReplaceAllFunc(data, func(token []byte) []byte {
+		n, _ := strconv.Atoi(string(token[len(helmActionPrefix):]))
+		return []byte(t.actions[n])
+	}), nil
+}
+
+var helmActionToken = regexp.MustCompile(helmActionPrefix + `[0-9]{6}`)
+
+// helmValues lists defaults of the parameters, those without one have to be set
+func helmValues(parameters []ModuleParameter) ([]byte, error) {
+	sorted := append([]ModuleParameter{}, parameters...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	buf := &bytes.Buffer{}
+	for n, p := range sorted {
+		if n > 0 {
+			buf.WriteString("\n")
+		}
+		if p.Description != "" {
+			fmt.Fprintf(buf, "# %s\n", strings.Replace(p.Description, "\n", "\n# ", -1))
+		}
+		if p.Required || p.Default == nil {
+			fmt.Fprintf(buf, "# (required)\n")
+		}
+		var value interface{}
+		if !p.Required {
+			value = p.Default
+		}
+		data, err := yaml.Marshal(map[string]interface{}{p.Name: value})
+		if err != nil {
+			return nil, fmt.Errorf("error encoding default value of parameter %q – %v", p.Name, err)
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteToDir writes all of the files of the chart to dir, files of a chart that was exported
+// there previously are overwritten, but any others are kept
+func (c *HelmChart) WriteToDir(dir string) ([]string, error) {
+	filenames := []string{}
+	for filename := range c.Files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	filesWritten := []string{}
+	for _, filename := range filenames {
+		outputFilename := path.Join(dir, filename)
+		if err := os.MkdirAll(path.Dir(outputFilename), 0755); err != nil {
+			return nil, fmt.Errorf("error creating output directory %q – %v", path.Dir(outputFilename), err)
+		}
+		if err := ioutil.WriteFile(outputFilename, c.Files[filename], 0644); err != nil {
+			return nil, fmt.Errorf("error writing to file %q – %v", outputFilename, err)
+		}
+		filesWritten = append(filesWritten, outputFilename)
+	}
+	return filesWritten, nil
+}
@@ -0,0 +1,173 @@
+package modules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportHelmChart(t *testing.T) {
+	module := `
+Kind: kubegen.k8s.io/Module.v1alpha2
+Parameters:
+- name: registry
+  type: String
+  default: docker.io
+  description: Registry to pull the image from
+- name: replicas
+  type: Number
+  default: 2
+- name: domain
+  type: String
+  required: true
+- name: cpu
+  type: String
+  default: 100m
+Internals:
+- name: image
+  type: String
+  value: { kubegen.String.Join: [{ kubegen.String.Lookup: registry }, /app:1] }
+Deployments:
+- name: app
+  replicas: { kubegen.Number.Lookup: replicas }
+  containers:
+  - name: app
+    image: { kubegen.String.Lookup: image }
+    args:
+    - kubegen.String.Join: [--domain=, { kubegen.String.Lookup: domain }]
+    - --workers=2000000001
+    - "--template={{ .Name }}"
+    env:
+      CPU: { kubegen.String.Lookup: cpu }
+      WORKERS: "2000000001"
+`
+	tests := []struct {
+		files map[string]string
+		err   string
+	}{
+		{
+			files: map[string]string{"app/app.yml": module},
+		},
+		{
+			files: map[string]string{"app/app.yml": strings.Replace(module,
+				`      CPU: { kubegen.String.Lookup: cpu }`,
+				`      CPU: 100m
+    resources:
+      requests: { cpu: { kubegen.String.Lookup: cpu } }`, 1)},
+			err: `parameters ["cpu"] are used in fields that only accept values of a particular format (e.g. quantities), which cannot be set from templates`,
+		},
+		{
+			files: map[string]string{
+				"app/app.yml": module,
+				"app/config.yml": `
+Kind: kubegen.k8s.io/Module.v1alpha2
+ConfigMaps:
+- name: app
+  data:
+    config.yml: { kubegen.String.AsYAML: { domain: { kubegen.String.Lookup: domain } } }
+`,
+			},
+			err: "only lookups and joins can be expressed in templates, found:\n" +
+				`  – kubegen.String.AsYAML at ["ConfigMaps"][0]["data"]["config.yml"] in "config.yml"`,
+		},
+		{
+			files: map[string]string{"app/app.yml": strings.Replace(module, "  type: Number\n", "  type: Array\n", 1)},
+			err:   `parameter "replicas" is of type "Array", which cannot be exported to Helm`,
+		},
+	}
+
+	for _, test := range tests {
+		dir := writeFiles(t, test.files)
+		defer os.RemoveAll(dir)
+
+		chart, err := ExportHelmChart(filepath.Join(dir, "app"), "app", "1.2.3")
+		if test.err != "" {
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "apiVersion: v2\ndescription: Generated by kubegen from module \"app\"\nname: app\ntype: application\nversion: 1.2.3\n",
+			string(chart.Files["Chart.yaml"]))
+		assert.Equal(t, `cpu: 100m
+
+# (required)
+domain: null
+
+# Registry to pull the image from
+registry: docker.io
+
+replicas: 2
+`, string(chart.Files["values.yaml"]))
+
+		template := string(chart.Files["templates/app.yaml"])
+		assert.Contains(t, template, "# Generated by kubegen from \"app.yml\"\n")
+		assert.Contains(t, template, "\n  replicas: {{ .Values.replicas }}\n")
+		assert.Contains(t, template, "\n        image: {{ .Values.registry }}/app:1\n")
+		assert.Contains(t, template, "\n        - --domain={{ required \"value \\\"domain\\\" must be set\" .Values.domain }}\n")
+		assert.Contains(t, template, "\n          value: {{ .Values.cpu | quote }}\n")
+		// literal values are kept as they are, even if these look like placeholders or actions
+		assert.Contains(t, template, "\n        - --workers=2000000001\n")
+		assert.Contains(t, template, "\n          value: \"2000000001\"\n")
+		assert.Contains(t, template, "\n        - --template={{ \"{{\" }} .Name }}\n")
+		assert.NotContains(t, template, "kubegenHelm")
+	}
+}
+
+func TestHelmTemplater(t *testing.T) {
+	parameters := []ModuleParameter{
+		{Name: "name", Type: "String", Default: "app"},
+		{Name: "port", Type: "Number", Default: 80},
+	}
+	templater := &helmTemplater{parameters: parameters, placeholders: map[string]interface{}{}, otherPlaceholders: map[string]interface{}{}}
+	for n, p := range parameters {
+		templater.placeholders[p.Name], _ = helmPlaceholder(p, n, 0)
+		templater.otherPlaceholders[p.Name], _ = helmPlaceholder(p, n, 1)
+	}
+	placeholder := func(variant int, name string) interface{} {
+		if variant == 0 {
+			return templater.placeholders[name]
+		}
+		return templater.otherPlaceholders[name]
+	}
+	render := func(variant int) []object {
+		return []object{{
+			"name":    placeholder(variant, "name"),
+			"port":    float64(placeholder(variant, "port").(int32)),
+			"literal": float64(placeholder(0, "port").(int32)),
+			"args":    []interface{}{fmt.Sprintf("--name=%v:%v", placeholder(variant, "name"), placeholder(variant, "port"))},
+		}}
+	}
+
+	template, ok := templater.template(render(0), render(1))
+	if assert.True(t, ok) {
+		data, err := templater.encode(template, "app.yml")
+		assert.NoError(t, err)
+		assert.Equal(t, `# Generated by kubegen from "app.yml"
+args:
+- --name={{ .Values.name }}:{{ .Values.port }}
+literal: 2000000001
+name: {{ .Values.name | quote }}
+port: {{ .Values.port }}
+`, string(data))
+	}
+
+	// a value that differs in any other way must have been transformed
+	transformed := render(1)
+	transformed[0]["name"] = "YXBw"
+	_, ok = templater.template(render(0), transformed)
+	assert.False(t, ok)
+
+	transformed = render(1)
+	transformed[0]["args"] = []interface{}{fmt.Sprintf("--name=%v", placeholder(1, "name"))}
+	_, ok = templater.template(render(0), transformed)
+	assert.False(t, ok)
+}
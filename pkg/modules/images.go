@@ -0,0 +1,110 @@
+package modules
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ImageOverride replaces name, tag or digest of an image used by any of the containers,
+// Name is matched against the image without its tag or digest
+type ImageOverride struct {
+	Name    string `yaml:"Name" json:"Name" hcl:",key"`
+	NewName string `yaml:"NewName,omitempty" json:"NewName,omitempty" hcl:"new_name"`
+	NewTag  string `yaml:"NewTag,omitempty" json:"NewTag,omitempty" hcl:"new_tag"`
+	Digest  string `yaml:"Digest,omitempty" json:"Digest,omitempty" hcl:"digest"`
+}
+
+func (o ImageOverride) validate() error {
+	if o.Name == "" {
+		return fmt.Errorf("image override must have `Name` set")
+	}
+	if o.NewName == "" && o.NewTag == "" && o.Digest == "" {
+		return fmt.Errorf("image override %q must have `NewName`, `NewTag` or `Digest` set", o.Name)
+	}
+	if o.NewTag != "" && o.Digest != "" {
+		return fmt.Errorf("image override %q must have either `NewTag` or `Digest` set, not both", o.Name)
+	}
+	return nil
+}
+
+// mergeImageOverrides returns overrides from base, unless override has one with the same name
+func mergeImageOverrides(base, override []ImageOverride) []ImageOverride {
+	if len(base) == 0 {
+		return override
+	}
+	overridden := make(map[string]bool, len(override))
+	for _, o := range override {
+		overridden[o.Name] = true
+	}
+	result := []ImageOverride{}
+	for _, o := range base {
+		if !overridden[o.Name] {
+			result = append(result, o)
+		}
+	}
+	return append(result, override...)
+}
+
+// splitImage splits an image reference into name, tag and digest, a colon is
+// only taken as a tag separator after the last slash, as it may denote a port
+func splitImage(image string) (name, tag, digest string) {
+	name = image
+	if n := strings.Index(name, "@"); n >= 0 {
+		name, digest = name[:n], name[n+1:]
+	}
+	if n := strings.LastIndex(name, ":"); n > strings.LastIndex(name, "/") {
+		name, tag = name[:n], name[n+1:]
+	}
+	return name, tag, digest
+}
+
+func (o ImageOverride) apply(image string) (string, bool) {
+	name, tag, digest := splitImage(image)
+	if name != o.Name {
+		return image, false
+	}
+
+	if o.NewName != "" {
+		name = o.NewName
+	}
+	if o.NewTag != "" {
+		tag, digest = o.NewTag, ""
+	}
+	if o.Digest != "" {
+		tag, digest = "", o.Digest
+	}
+
+	if tag != "" {
+		name += ":" + tag
+	}
+	if digest != "" {
+		name += "@" + digest
+	}
+	return name, true
+}
+
+// overrideImages applies overrides to all containers in objects that have a pod template,
+// it returns names of the overrides that matched at least one container
+func overrideImages(objs []object, overrides []ImageOverride) map[string]bool {
+	matched := make(map[string]bool, len(overrides))
+	for _, obj := range objs {
+		podSpec := getPodSpec(obj)
+		if podSpec == nil {
+			continue
+		}
+		for _, container := range getContainers(podSpec) {
+			image, ok := container["image"].(string)
+			if !ok {
+				continue
+			}
+			for _, o := range overrides {
+				if newImage, ok := o.apply(image); ok {
+					container["image"] = newImage
+					matched[o.Name] = true
+					break
+				}
+			}
+		}
+	}
+	return matched
+}
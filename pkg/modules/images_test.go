@@ -0,0 +1,161 @@
+package modules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageOverrides(t *testing.T) {
+	tests := []struct {
+		image    string
+		override ImageOverride
+		result   string
+	}{
+		{"app:1", ImageOverride{Name: "app", NewTag: "2"}, "app:2"},
+		{"app", ImageOverride{Name: "app", NewTag: "2"}, "app:2"},
+		{"app:1", ImageOverride{Name: "app", NewName: "quay.io/app"}, "quay.io/app:1"},
+		{"app:1", ImageOverride{Name: "app", Digest: "sha256:abc"}, "app@sha256:abc"},
+		{"app@sha256:abc", ImageOverride{Name: "app", NewTag: "2"}, "app:2"},
+		{"localhost:5000/app:1", ImageOverride{Name: "localhost:5000/app", NewTag: "2"}, "localhost:5000/app:2"},
+		{"localhost:5000/app", ImageOverride{Name: "localhost", NewTag: "2"}, ""},
+		{"app:1", ImageOverride{Name: "ap", NewTag: "2"}, ""},
+	}
+	for _, test := range tests {
+		result, ok := test.override.apply(test.image)
+		if test.result == "" {
+			assert.False(t, ok, test.image)
+			assert.Equal(t, test.image, result)
+			continue
+		}
+		assert.True(t, ok, test.image)
+		assert.Equal(t, test.result, result)
+	}
+}
+
+func TestImages(t *testing.T) {
+	module := `
+Kind: kubegen.k8s.io/Module.v1alpha2
+Deployments:
+- name: app
+  initContainers: [{ name: migrate, image: "app:1" }]
+  containers: [{ name: app, image: "app:1" }, { name: proxy, image: "proxy:1" }]
+Resources:
+- path: worker.yml
+`
+	worker := `
+apiVersion: batch/v1
+kind: Job
+metadata: { name: worker }
+spec:
+  template:
+    spec:
+      restartPolicy: Never
+      containers: [{ name: worker, image: "registry.example.com:5000/worker:1" }]
+`
+	tests := []struct {
+		images  string
+		result  []string
+		warning string
+		err     string
+	}{
+		{
+			`
+Images:
+- { Name: app, NewTag: "2" }
+- { Name: proxy, NewName: quay.io/proxy }
+- { Name: registry.example.com:5000/worker, Digest: "sha256:abc" }
+Modules:
+- Name: app
+  SourceDir: modules/app
+`,
+			[]string{"app:2", "app:2", "quay.io/proxy:1", "registry.example.com:5000/worker@sha256:abc"},
+			"",
+			"",
+		},
+		{
+			`
+Images:
+- { Name: app, NewTag: "2" }
+- { Name: db, NewTag: "2" }
+Modules:
+- Name: app
+  SourceDir: modules/app
+  Images:
+  - { Name: app, NewTag: "3" }
+`,
+			[]string{"app:3", "app:3", "proxy:1", "registry.example.com:5000/worker:1"},
+			`image override "db" did not match any containers in modules [app]`,
+			"",
+		},
+		{
+			`
+Modules:
+- Name: app
+  SourceDir: modules/app
+  Images:
+  - { Name: app }
+`,
+			nil, "",
+			`error in module "app" – image override "app" must have ` + "`NewName`, `NewTag` or `Digest` set",
+		},
+		{
+			`
+Images:
+- { Name: app, NewTag: "2", Digest: "sha256:abc" }
+Modules:
+- Name: app
+  SourceDir: modules/app
+`,
+			nil, "",
+			`error in module "app" – image override "app" must have either ` + "`NewTag` or `Digest` set, not both",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.err, func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{
+				"modules/app/app.yml":    module,
+				"modules/app/worker.yml": worker,
+				"bundle.yml":             "Kind: kubegen.k8s.io/Bundle.v1alpha2\n" + test.images,
+			})
+			defer os.RemoveAll(dir)
+
+			bundle, err := NewBundle(filepath.Join(dir, "bundle.yml"))
+			if err == nil {
+				bundle.omitVersion = true
+				err = bundle.LoadModules(nil)
+			}
+			if test.err != "" {
+				if assert.Error(t, err) {
+					assert.Equal(t, test.err, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			objs, err := generateObjects(bundle)
+			if err != nil {
+				t.Fatal(err)
+			}
+			images := []string{}
+			for _, obj := range objs {
+				for _, container := range getContainers(getPodSpec(obj)) {
+					images = append(images, container["image"].(string))
+				}
+			}
+			assert.Equal(t, test.result, images)
+
+			warnings := bundle.Warnings()
+			if test.warning == "" {
+				assert.Empty(t, warnings)
+			} else {
+				assert.Equal(t, []string{test.warning}, warnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package modules
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/errordeveloper/kubegen/pkg/util"
+)
+
+// Layouts of the output directory, i.e. how generated resources are split into files
+const (
+	// LayoutPerManifest writes a list of resources for each of the manifests in the module (default)
+	LayoutPerManifest = "per-manifest"
+	// LayoutPerResource writes each of the resources to "<kind>-<name>.<format>"
+	LayoutPerResource = "per-resource"
+	// LayoutSingleFile writes all resources to "<name of the module instance>.<format>"
+	LayoutSingleFile = "single-file"
+	// LayoutPerKindDirectory writes each of the resources to "<kind>/<name>.<format>"
+	LayoutPerKindDirectory = "per-kind-directory"
+)
+
+var OutputLayouts = []string{LayoutPerManifest, LayoutPerResource, LayoutSingleFile, LayoutPerKindDirectory}
+
+// SetOutputLayout sets how WriteToOutputDir splits generated resources into files
+func (b *Bundle) SetOutputLayout(layout string) error {
+	for _, l := range OutputLayouts {
+		if l == layout {
+			b.outputLayout = layout
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown output layout %q, must be one of %q", layout, OutputLayouts)
+}
+
+// encodeFiles returns contents of the files to write to the output directory of the module instance, keyed
+// by names of the files relative to it, contentType is either "yaml" or "json", as it's used as extension
+func (m *Module) encodeFiles(instance ModuleInstance, contentType, layout string) (map[string][]byte, error) {
+	switch layout {
+	case LayoutPerResource, LayoutPerKindDirectory:
+		return m.encodeResourceFiles(instance, contentType, layout == LayoutPerKindDirectory)
+	case LayoutSingleFile:
+		// unlike YAML documents or NDJSON, lists cannot be concatenated, so all of the objects go into one list
+		if contentType == "json" && m.jsonStyle != JSONStyleNDJSON {
+			return m.encodeSingleJSONList(instance)
+		}
+	}
+
+	var (
+		groups map[ManifestPath][]byte
+		err    error
+	)
+	switch contentType {
+	case "yaml":
+		groups, err = m.EncodeGroupsToYAML(instance)
+	case "json":
+		groups, err = m.EncodeGroupsToJSON(instance)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte, len(groups))
+
+	if layout == LayoutSingleFile {
+		manifestPaths := []string{}
+		for manifestPath := range groups {
+			manifestPaths = append(manifestPaths, manifestPath)
+		}
+		sort.Strings(manifestPaths)
+
+		// the file is the same as what gets written to stdout, apart from JSON lists
+		data := []byte{}
+		for _, manifestPath := range manifestPaths {
+			data = append(data, groups[manifestPath]...)
+		}
+		if len(data) > 0 {
+			files[path.Base(instance.Name)+"."+contentType] = data
+		}
+		return files, nil
+	}
+
+	// with NDJSON style the extension is still ".json", as kubectl reads any number of objects from such files
+	for manifestPath, group := range groups {
+		// nested directories in the module are mirrored in the output directory
+		files[strings.TrimSuffix(m.relativePath(manifestPath), path.Ext(manifestPath))+"."+contentType] = group
+	}
+	return files, nil
+}
+
+// encodeSingleJSONList returns a file with one list of all objects generated from the module, in the same order as
+// these are written to stdout
+func (m *Module) encodeSingleJSONList(instance ModuleInstance) (map[string][]byte, error) {
+	lists, err := m.makeLists(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestPaths := []string{}
+	for manifestPath := range lists {
+		manifestPaths = append(manifestPaths, manifestPath)
+	}
+	sort.Strings(manifestPaths)
+
+	list := &metav1.List{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "List",
+			APIVersion: "v1",
+		},
+	}
+	for _, manifestPath := range manifestPaths {
+		list.Items = append(list.Items, lists[manifestPath].Items...)
+	}
+
+	files := make(map[string][]byte, 1)
+	if len(list.Items) == 0 {
+		return files, nil
+	}
+
+	data, err := util.EncodeList(list, "application/json", true)
+	if err != nil {
+		return nil, m.redactError(err)
+	}
+
+	if data, err = m.maskSensitiveValuesInOutput("application/json", data, true); err != nil {
+		return nil, err
+	}
+
+	files[path.Base(instance.Name)+".json"] = append(data, byte('\n'))
+	return files, nil
+}
+
+func (m *Module) encodeResourceFiles(instance ModuleInstance, contentType string, perKindDirectory bool) (map[string][]byte, error) {
+	lists, err := m.makeLists(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceHash, err := m.SourceHash(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestPaths := []string{}
+	for manifestPath := range lists {
+		manifestPaths = append(manifestPaths, manifestPath)
+	}
+	sort.Strings(manifestPaths)
+
+	files := make(map[string][]byte)
+	filesFrom := make(map[string]ManifestPath)
+	for _, manifestPath := range manifestPaths {
+		for _, item := range lists[manifestPath].Items {
+			filename, err := util.ObjectFilename(item.Object, contentType, perKindDirectory)
+			if err != nil {
+				return nil, err
+			}
+			if previous, ok := filesFrom[filename]; ok {
+				return nil, fmt.Errorf(
+					"cannot write resources of module %q to %q – same kind and name is defined in %q and %q",
+					instance.Name, filename, m.relativePath(previous), m.relativePath(manifestPath))
+			}
+			filesFrom[filename] = manifestPath
+
+			data, err := util.Encode(item.Object, "application/"+contentType, contentType == "json")
+			if err != nil {
+				return nil, m.redactError(err)
+			}
+
+			if data, err = m.maskSensitiveValuesInOutput("application/"+contentType, data, contentType == "json"); err != nil {
+				return nil, err
+			}
+
+			switch contentType {
+			case "yaml":
+				files[filename] = append([]byte(m.yamlHeader(instance, manifestPath, sourceHash)), data...)
+			case "json":
+				files[filename] = append(data, byte('\n'))
+			}
+		}
+	}
+
+	return files, nil
+}
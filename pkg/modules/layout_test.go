@@ -0,0 +1,131 @@
+package modules
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputLayouts(t *testing.T) {
+	db := `
+Kind: kubegen.k8s.io/Module.v1alpha2
+Deployments:
+- name: db
+  containers: [{ name: db, image: "db:1" }]
+Services:
+- name: db
+  ports: [{ name: db, port: 5432 }]
+`
+	tests := []struct {
+		layout, contentType, jsonStyle string
+		written                        []string
+	}{
+		{LayoutPerManifest, "yaml", JSONStyleList, []string{"app.yaml", "db.yaml"}},
+		{LayoutPerResource, "yaml", JSONStyleList, []string{"deployment-app.yaml", "deployment-db.yaml", "service-db.yaml"}},
+		{LayoutPerKindDirectory, "json", JSONStyleList, []string{"deployment/app.json", "deployment/db.json", "service/db.json"}},
+		{LayoutSingleFile, "yaml", JSONStyleList, []string{"app.yaml"}},
+		{LayoutSingleFile, "json", JSONStyleList, []string{"app.json"}},
+		{LayoutSingleFile, "json", JSONStyleNDJSON, []string{"app.json"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.layout+"/"+test.contentType+"/"+test.jsonStyle, func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{
+				"app/app.yml": appModule,
+				"app/db.yml":  db,
+			})
+			defer os.RemoveAll(dir)
+
+			bundle, err := loadBundle(ModuleInstance{
+				Name:       "app",
+				SourceDir:  filepath.Join(dir, "app"),
+				OutputDir:  filepath.Join(dir, "out"),
+				Parameters: map[string]interface{}{"domain": "example.com"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := bundle.SetOutputLayout(test.layout); err != nil {
+				t.Fatal(err)
+			}
+			bundle.jsonStyle = test.jsonStyle
+			for n := range bundle.loadedModules {
+				bundle.loadedModules[n].jsonStyle = test.jsonStyle
+			}
+
+			written, err := bundle.WriteToOutputDir(test.contentType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for n := range written {
+				written[n] = filepath.ToSlash(strings.TrimPrefix(written[n], filepath.Join(dir, "out")+"/"))
+			}
+			assert.Equal(t, test.written, written)
+
+			if test.contentType != "json" {
+				return
+			}
+			for _, file := range written {
+				data, err := ioutil.ReadFile(filepath.Join(dir, "out", file))
+				if err != nil {
+					t.Fatal(err)
+				}
+				// each of the files has to be decoded as a whole, apart from NDJSON
+				documents := [][]byte{data}
+				if test.jsonStyle == JSONStyleNDJSON {
+					documents = bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+					assert.Len(t, documents, 3)
+				}
+				for _, document := range documents {
+					obj := object{}
+					assert.NoError(t, json.Unmarshal(document, &obj), file)
+				}
+				if test.layout == LayoutSingleFile && test.jsonStyle == JSONStyleList {
+					obj := object{}
+					json.Unmarshal(data, &obj)
+					assert.Equal(t, "List", obj["kind"])
+					assert.Len(t, obj["items"], 3)
+				}
+			}
+		})
+	}
+
+	// files of sub-modules are named after these, not their full names, as these go to their own directory
+	for _, contentType := range []string{"yaml", "json"} {
+		dir := writeFiles(t, map[string]string{
+			"app/app.yml": appModule + "Modules:\n- Name: db\n  SourceDir: ../db\n",
+			"db/db.yml":   db,
+		})
+		defer os.RemoveAll(dir)
+
+		bundle, err := loadBundle(ModuleInstance{
+			Name:       "app",
+			SourceDir:  filepath.Join(dir, "app"),
+			OutputDir:  filepath.Join(dir, "out"),
+			Parameters: map[string]interface{}{"domain": "example.com"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bundle.SetOutputLayout(LayoutSingleFile); err != nil {
+			t.Fatal(err)
+		}
+		written, err := bundle.WriteToOutputDir(contentType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for n := range written {
+			written[n] = filepath.ToSlash(strings.TrimPrefix(written[n], filepath.Join(dir, "out")+"/"))
+		}
+		assert.Equal(t, []string{"app." + contentType, "db/db." + contentType}, written)
+	}
+
+	assert.EqualError(t, (&Bundle{}).SetOutputLayout("flat"),
+		`unknown output layout "flat", must be one of ["per-manifest" "per-resource" "single-file" "per-kind-directory"]`)
+}
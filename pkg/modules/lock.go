@@ -0,0 +1,244 @@
+package modules
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	LockKind     = "kubegen.k8s.io/Lock.v1alpha1"
+	LockFileName = "kubegen.lock"
+)
+
+// Lock records sources and hashes of module instances in each of the bundles
+// found in the same directory, so that changes in any of the modules can be detected
+type Lock struct {
+	Kind    string                    `yaml:"Kind" json:"Kind"`
+	Bundles map[string][]LockedModule `yaml:"Bundles" json:"Bundles"`
+}
+
+type LockedModule struct {
+	Name      string `yaml:"Name" json:"Name"`
+	OutputDir string `yaml:"OutputDir" json:"OutputDir"`
+	Source    string `yaml:"Source,omitempty" json:"Source,omitempty"`
+	SourceDir string `yaml:"SourceDir,omitempty" json:"SourceDir,omitempty"`
+	Revision  string `yaml:"Revision,omitempty" json:"Revision,omitempty"`
+	Hash      string `yaml:"Hash" json:"Hash"`
+}
+
+func (l LockedModule) key() string { return l.Name + " " + l.OutputDir }
+
+// Hash is a checksum of all of the files in the module
+func (m *Module) Hash() (string, error) {
+	files := make(map[string][]byte, len(m.manifests)+len(m.Resources))
+	for manifestPath, data := range m.manifests {
+		files[manifestPath] = data
+	}
+	for _, resource := range m.Resources {
+		resourcePath := path.Join(m.directory, resource.Path)
+		data, err := ioutil.ReadFile(resourcePath)
+		if err != nil {
+			return "", fmt.Errorf("error reading file %q in module %q – %v", resource.Path, m.directory, err)
+		}
+		files[resourcePath] = data
+	}
+
+	names := []string{}
+	relNames := make(map[string]string, len(files))
+	for filePath := range files {
+		rel, err := filepath.Rel(m.directory, filePath)
+		if err != nil {
+			rel = filePath
+		}
+		names = append(names, rel)
+		relNames[rel] = filePath
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		data := files[relNames[name]]
+		fmt.Fprintf(h, "%s %d\n", filepath.ToSlash(name), len(data))
+		h.Write(data)
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+func (b *Bundle) lockFilePath() string { return path.Join(path.Dir(b.path), LockFileName) }
+
+// relativePath makes the path relative to the directory of the bundle, even if either of these is absolute,
+// so that the lock file doesn't depend on where the bundle is checked out, or how its path is given
+func (b *Bundle) relativePath(p string) string {
+	bundleDir, err := filepath.Abs(path.Dir(b.path))
+	if err != nil {
+		return p
+	}
+	absPath, err := filepath.Abs(p)
+	if err != nil {
+		return p
+	}
+	rel, err := filepath.Rel(bundleDir, absPath)
+	if err != nil {
+		return p
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (b *Bundle) lockedModules() ([]LockedModule, error) {
+	lockedModules := []LockedModule{}
+	for _, m := range b.loadedModules {
+		hash, err := m.Hash()
+		if err != nil {
+			return nil, err
+		}
+		l := LockedModule{
+			Name:      m.instance.Name,
+			OutputDir: m.instance.OutputDir,
+			Hash:      hash,
+		}
+		if m.source != nil {
+			l.Source = m.source.uri
+			l.Revision = m.source.revision
+		} else {
+			// sub-modules are relative to the parent, so make it relative to the bundle
+			l.SourceDir = b.relativePath(m.directory)
+		}
+		lockedModules = append(lockedModules, l)
+	}
+	return lockedModules, nil
+}
+
+func readLockFile(lockFilePath string) (*Lock, error) {
+	lock := &Lock{Kind: LockKind, Bundles: make(map[string][]LockedModule)}
+
+	data, err := ioutil.ReadFile(lockFilePath)
+	if os.IsNotExist(err) {
+		return lock, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading lock file %q – %v", lockFilePath, err)
+	}
+
+	if err := yaml.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("error loading lock file %q – %v", lockFilePath, err)
+	}
+	if lock.Kind != LockKind {
+		return nil, fmt.Errorf(
+			"error loading lock file %q – unrecognised `Kind: %q`, must be %q",
+			lockFilePath, lock.Kind, LockKind)
+	}
+	if lock.Bundles == nil {
+		lock.Bundles = make(map[string][]LockedModule)
+	}
+
+	return lock, nil
+}
+
+// UpdateLockFile records the modules that were loaded in the lock file, unless nothing has changed
+func (b *Bundle) UpdateLockFile() error {
+	lockFilePath := b.lockFilePath()
+
+	lock, err := readLockFile(lockFilePath)
+	if err != nil {
+		return err
+	}
+
+	lockedModules, err := b.lockedModules()
+	if err != nil {
+		return err
+	}
+
+	bundleName := path.Base(b.path)
+
+	// when only some modules were selected, others remain as they were
+	if b.selectedModulesOnly {
+		updated := make(map[string]bool, len(lockedModules))
+		for _, l := range lockedModules {
+			updated[l.key()] = true
+		}
+		for _, l := range lock.Bundles[bundleName] {
+			if !updated[l.key()] {
+				lockedModules = append(lockedModules, l)
+			}
+		}
+	}
+
+	previousData, err := yaml.Marshal(lock.Bundles[bundleName])
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(lockedModules)
+	if err != nil {
+		return err
+	}
+	if string(previousData) == string(data) {
+		return nil
+	}
+
+	lock.Bundles[bundleName] = lockedModules
+	if data, err = yaml.Marshal(lock); err != nil {
+		return fmt.Errorf("error encoding lock file %q – %v", lockFilePath, err)
+	}
+	if err := ioutil.WriteFile(lockFilePath, data, 0644); err != nil {
+		return fmt.Errorf("error writing to file %q – %v", lockFilePath, err)
+	}
+	return nil
+}
+
+// VerifyLockFile checks that each of the modules that were loaded match the lock file
+func (b *Bundle) VerifyLockFile() error {
+	lockFilePath := b.lockFilePath()
+
+	lock, err := readLockFile(lockFilePath)
+	if err != nil {
+		return err
+	}
+
+	lockedModules, err := b.lockedModules()
+	if err != nil {
+		return err
+	}
+
+	bundleName := path.Base(b.path)
+
+	locked := make(map[string]LockedModule, len(lock.Bundles[bundleName]))
+	for _, l := range lock.Bundles[bundleName] {
+		locked[l.key()] = l
+	}
+
+	mismatches := []string{}
+	for _, l := range lockedModules {
+		previous, ok := locked[l.key()]
+		switch {
+		case !ok:
+			mismatches = append(mismatches, fmt.Sprintf("module %q is not locked", l.Name))
+		case previous.Source != l.Source || previous.SourceDir != l.SourceDir:
+			mismatches = append(mismatches, fmt.Sprintf("source of module %q has changed", l.Name))
+		case previous.Revision != l.Revision:
+			mismatches = append(mismatches, fmt.Sprintf("module %q is at revision %q, but %q is locked", l.Name, l.Revision, previous.Revision))
+		case previous.Hash != l.Hash:
+			mismatches = append(mismatches, fmt.Sprintf("contents of module %q has changed", l.Name))
+		}
+		delete(locked, l.key())
+	}
+	if !b.selectedModulesOnly {
+		for _, l := range lock.Bundles[bundleName] {
+			if _, ok := locked[l.key()]; ok {
+				mismatches = append(mismatches, fmt.Sprintf("module %q is locked, but no longer used", l.Name))
+			}
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return fmt.Errorf("bundle %q doesn't match lock file %q – %s", b.path, lockFilePath, strings.Join(mismatches, ", "))
+	}
+	return nil
+}
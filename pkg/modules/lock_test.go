@@ -0,0 +1,88 @@
+package modules
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockFile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"modules/app/app.yml": appModule,
+		"bundle.yml": `
+Kind: kubegen.k8s.io/Bundle.v1alpha2
+Parameters:
+  domain: example.com
+Modules:
+- Name: prod
+  SourceDir: modules/app
+- Name: test
+  SourceDir: modules/app
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	load := func(selectModules []string) *Bundle {
+		bundle, err := NewBundle(filepath.Join(dir, "bundle.yml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bundle.LoadModules(selectModules); err != nil {
+			t.Fatal(err)
+		}
+		return bundle
+	}
+
+	if err := load(nil).VerifyLockFile(); assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `module "prod" is not locked, module "test" is not locked`)
+	}
+
+	if err := load(nil).UpdateLockFile(); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, load(nil).VerifyLockFile())
+
+	lock, err := readLockFile(filepath.Join(dir, LockFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, lock.Bundles["bundle.yml"], 2) {
+		assert.Equal(t, "modules/app", lock.Bundles["bundle.yml"][0].SourceDir)
+	}
+
+	// the lock doesn't depend on whether the path of the bundle is absolute
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := NewBundle(filepath.Join(absDir, "bundle.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bundle.LoadModules(nil); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, bundle.VerifyLockFile())
+
+	appModulePath := filepath.Join(dir, "modules/app/app.yml")
+	if err := ioutil.WriteFile(appModulePath, []byte(strings.Replace(appModule, "app:1", "app:2", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := load(nil).VerifyLockFile(); assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `contents of module "prod" has changed, contents of module "test" has changed`)
+	}
+
+	// updating only some of the modules leaves the others as they were
+	if err := load([]string{"prod"}).UpdateLockFile(); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, load([]string{"prod"}).VerifyLockFile())
+	if err := load(nil).VerifyLockFile(); assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `contents of module "test" has changed`)
+		assert.NotContains(t, err.Error(), `"prod"`)
+	}
+}
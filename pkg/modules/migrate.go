@@ -0,0 +1,524 @@
+package modules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/hashicorp/hcl/hcl/ast"
+	hclparser "github.com/hashicorp/hcl/hcl/parser"
+	"github.com/hashicorp/hcl/hcl/printer"
+	"github.com/hashicorp/hcl/hcl/token"
+
+	"github.com/errordeveloper/kubegen/pkg/util"
+)
+
+const (
+	ModuleKindV1alpha1 = "kubegen.k8s.io/Module.v1alpha1"
+	BundleKindV1alpha1 = "kubegen.k8s.io/Bundle.v1alpha1"
+)
+
+// conversion upgrades a manifest from one version to the next one, Convert operates on
+// generic representation of YAML and JSON (as well as HCL, when it's only loaded), while
+// ConvertHCL operates on the syntax tree, so that HCL files can be rewritten as they are,
+// and ConvertText applies whatever it can to YAML and JSON text, so that comments are kept
+type conversion struct {
+	From, To    string
+	Convert     func(obj map[string]interface{}) error
+	ConvertHCL  func(file *ast.File) error
+	ConvertText func(data []byte) []byte
+}
+
+var conversions = []conversion{
+	{
+		From:        ModuleKindV1alpha1,
+		To:          ModuleKind,
+		Convert:     convertModuleV1alpha1,
+		ConvertHCL:  convertModuleV1alpha1HCL,
+		ConvertText: convertModuleV1alpha1Text,
+	},
+	{
+		// there were no changes to the bundle, other than the version
+		From:        BundleKindV1alpha1,
+		To:          BundleKind,
+		Convert:     func(map[string]interface{}) error { return nil },
+		ConvertHCL:  func(*ast.File) error { return nil },
+		ConvertText: func(data []byte) []byte { return data },
+	},
+}
+
+// conversionsFrom returns the chain of conversions needed to upgrade the kind to the latest version,
+// or nil if the kind is the latest version already, or it's not known (e.g. a raw resource)
+func conversionsFrom(kind string) []conversion {
+	chain := []conversion{}
+	for {
+		found := false
+		for _, c := range conversions {
+			if c.From == kind {
+				chain = append(chain, c)
+				kind = c.To
+				found = true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+	return chain
+}
+
+// In v1alpha1, types of parameters were in lower case, lookups had a different syntax, and
+// `encodeAsYAML` or `encodeAsJSON` applied to each of the values of an object
+var (
+	parameterTypesV1alpha1 = map[string]string{
+		"string": "String",
+		"number": "Number",
+	}
+	lookupMacrosV1alpha1 = map[string]string{
+		"kubegen.stringValueFromParameter":   "kubegen.String.Lookup",
+		"kubegen.numbericValueFromParameter": "kubegen.Number.Lookup",
+		"kubegen.numericValueFromParameter":  "kubegen.Number.Lookup",
+	}
+	encodeMacrosV1alpha1 = map[string]string{
+		"encodeAsYAML": "kubegen.String.AsYAML",
+		"encodeAsJSON": "kubegen.String.AsJSON",
+	}
+
+	parameterTypeV1alpha1Text = regexp.MustCompile(`\btype"?\s*:\s*"?(string|number)\b`)
+)
+
+func convertModuleV1alpha1(obj map[string]interface{}) error {
+	convertType := func(parameter interface{}) {
+		if p, ok := parameter.(map[string]interface{}); ok {
+			if t, ok := p["type"].(string); ok && parameterTypesV1alpha1[t] != "" {
+				p["type"] = parameterTypesV1alpha1[t]
+			}
+		}
+	}
+
+	for k, v := range obj {
+		items, ok := v.([]interface{})
+		if !ok {
+			continue
+		}
+		switch k {
+		case "Parameters":
+			for _, item := range items {
+				convertType(item)
+			}
+		case "parameter":
+			// HCL blocks are keyed by name, i.e. `parameter "name" { ... }`
+			for _, item := range items {
+				if block, ok := item.(map[string]interface{}); ok {
+					for _, v := range block {
+						if parameters, ok := v.([]interface{}); ok {
+							for _, p := range parameters {
+								convertType(p)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return convertMacrosV1alpha1(obj)
+}
+
+// convertModuleV1alpha1Text renames types of parameters and lookups, but not `encodeAsYAML` or `encodeAsJSON`,
+// as these have to be restructured, so the result won't match and the manifest gets re-encoded instead
+func convertModuleV1alpha1Text(data []byte) []byte {
+	text := parameterTypeV1alpha1Text.ReplaceAllStringFunc(string(data), func(s string) string {
+		t := parameterTypeV1alpha1Text.FindStringSubmatch(s)[1]
+		return strings.TrimSuffix(s, t) + parameterTypesV1alpha1[t]
+	})
+	for oldKey, newKey := range lookupMacrosV1alpha1 {
+		text = strings.Replace(text, oldKey, newKey, -1)
+	}
+	return []byte(text)
+}
+
+func convertMacrosV1alpha1(v interface{}) error {
+	switch v.(type) {
+	case map[string]interface{}:
+		obj := v.(map[string]interface{})
+		keys := []string{}
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if newKey, ok := lookupMacrosV1alpha1[k]; ok {
+				obj[newKey] = obj[k]
+				delete(obj, k)
+				continue
+			}
+			if macro, ok := encodeMacrosV1alpha1[k]; ok {
+				value := obj[k]
+				if list, ok := value.([]interface{}); ok && len(list) == 1 {
+					// HCL blocks are decoded as lists
+					value = list[0]
+				}
+				values, ok := value.(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("value of `%s` must be an object", k)
+				}
+				delete(obj, k)
+				for valueKey, value := range values {
+					if _, ok := obj[valueKey]; ok {
+						return fmt.Errorf("cannot convert `%s`, key %q is already set", k, valueKey)
+					}
+					obj[valueKey] = map[string]interface{}{macro: value}
+				}
+			}
+		}
+		for _, x := range obj {
+			if err := convertMacrosV1alpha1(x); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, x := range v.([]interface{}) {
+			if err := convertMacrosV1alpha1(x); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func hclKey(key *ast.ObjectKey) string {
+	if key.Token.Type == token.STRING {
+		if s, err := strconv.Unquote(key.Token.Text); err == nil {
+			return s
+		}
+	}
+	return key.Token.Text
+}
+
+func setHCLKey(key *ast.ObjectKey, text string) {
+	if key.Token.Type == token.STRING {
+		text = strconv.Quote(text)
+	}
+	key.Token.Text = text
+}
+
+func hclString(node ast.Node) (string, bool) {
+	literal, ok := node.(*ast.LiteralType)
+	if !ok || literal.Token.Type != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(literal.Token.Text)
+	return s, err == nil
+}
+
+func convertModuleV1alpha1HCL(file *ast.File) error {
+	root, ok := file.Node.(*ast.ObjectList)
+	if !ok {
+		return nil
+	}
+
+	for _, item := range root.Items {
+		if len(item.Keys) == 0 || hclKey(item.Keys[0]) != "parameter" {
+			continue
+		}
+		parameter, ok := item.Val.(*ast.ObjectType)
+		if !ok {
+			continue
+		}
+		for _, field := range parameter.List.Items {
+			if len(field.Keys) == 0 || hclKey(field.Keys[0]) != "type" {
+				continue
+			}
+			if t, ok := hclString(field.Val); ok && parameterTypesV1alpha1[t] != "" {
+				field.Val.(*ast.LiteralType).Token.Text = strconv.Quote(parameterTypesV1alpha1[t])
+			}
+		}
+	}
+
+	return convertMacrosV1alpha1HCL(root)
+}
+
+func convertMacrosV1alpha1HCL(list *ast.ObjectList) error {
+	items := []*ast.ObjectItem{}
+	for _, item := range list.Items {
+		if len(item.Keys) == 1 {
+			k := hclKey(item.Keys[0])
+			if newKey, ok := lookupMacrosV1alpha1[k]; ok {
+				setHCLKey(item.Keys[0], newKey)
+			}
+			if macro, ok := encodeMacrosV1alpha1[k]; ok {
+				values, ok := item.Val.(*ast.ObjectType)
+				if !ok {
+					return fmt.Errorf("value of `%s` must be an object", k)
+				}
+				for _, value := range values.List.Items {
+					if len(value.Keys) == 0 {
+						continue
+					}
+					// the value gets nested, e.g. `"a.yml" { ... }` becomes `"a.yml" { kubegen.String.AsYAML { ... } }`
+					items = append(items, &ast.ObjectItem{
+						Keys: value.Keys[:1],
+						Val: &ast.ObjectType{
+							List: &ast.ObjectList{
+								Items: []*ast.ObjectItem{{
+									Keys:   append([]*ast.ObjectKey{{Token: token.Token{Type: token.IDENT, Text: macro}}}, value.Keys[1:]...),
+									Assign: value.Assign,
+									Val:    value.Val,
+								}},
+							},
+						},
+					})
+				}
+				continue
+			}
+		}
+		items = append(items, item)
+	}
+	list.Items = items
+
+	var err error
+	ast.Walk(list, func(n ast.Node) (ast.Node, bool) {
+		if err != nil {
+			return n, false
+		}
+		if nested, ok := n.(*ast.ObjectType); ok {
+			err = convertMacrosV1alpha1HCL(nested.List)
+			return n, false
+		}
+		return n, true
+	})
+	return err
+}
+
+// normalise makes a generic object look the same regardless of the format it came from,
+// e.g. HCL decodes lists of objects with a different type
+func normalise(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	obj := make(map[string]interface{})
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func getManifestKind(obj map[string]interface{}) string {
+	if kind, ok := obj["Kind"].(string); ok {
+		return kind
+	}
+	kind, _ := obj["kind"].(string)
+	return kind
+}
+
+func setManifestKind(obj map[string]interface{}, kind string) {
+	if _, ok := obj["kind"]; ok {
+		obj["kind"] = kind
+		return
+	}
+	obj["Kind"] = kind
+}
+
+// convertManifest upgrades a manifest of an older version to the latest one and encodes it in the same
+// format, YAML and JSON are edited as they are when possible, otherwise these are re-encoded, so comments
+// are lost and keys get sorted, while HCL is rewritten as it is, it returns the conversions that were
+// applied, or nil if the manifest is of the latest version already, or it's not known (e.g. a raw resource),
+// along with warnings about anything that is lost in the conversion
+func convertManifest(data []byte, manifestPath string) ([]byte, []conversion, []string, error) {
+	var chain []conversion
+
+	switch path.Ext(manifestPath) {
+	case ".hcl", ".kg":
+		file, err := hclparser.Parse(data)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error parsing %q as HCL – %v", manifestPath, err)
+		}
+		kindValue := findHCLKind(file)
+		if kindValue == nil {
+			return nil, nil, nil, nil
+		}
+		kind, _ := hclString(kindValue)
+		if chain = conversionsFrom(kind); chain == nil {
+			return nil, nil, nil, nil
+		}
+		for _, c := range chain {
+			if err := c.ConvertHCL(file); err != nil {
+				return nil, nil, nil, fmt.Errorf("error converting %q from %q to %q – %v", manifestPath, c.From, c.To, err)
+			}
+			kindValue.Token.Text = strconv.Quote(c.To)
+		}
+		buf := &bytes.Buffer{}
+		if err := printer.Fprint(buf, file); err != nil {
+			return nil, nil, nil, fmt.Errorf("error encoding %q as HCL – %v", manifestPath, err)
+		}
+		return append(buf.Bytes(), '\n'), chain, nil, nil
+	case ".json", ".yaml", ".yml":
+		var v interface{}
+		if err := util.LoadObj(&v, data, manifestPath, ""); err != nil {
+			return nil, nil, nil, err
+		}
+		if _, ok := v.(map[string]interface{}); !ok {
+			return nil, nil, nil, nil
+		}
+		obj, err := normalise(v)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if chain = conversionsFrom(getManifestKind(obj)); chain == nil {
+			return nil, nil, nil, nil
+		}
+		for _, c := range chain {
+			if err := c.Convert(obj); err != nil {
+				return nil, nil, nil, fmt.Errorf("error converting %q from %q to %q – %v", manifestPath, c.From, c.To, err)
+			}
+			setManifestKind(obj, c.To)
+		}
+		if out, ok := convertText(data, manifestPath, chain, obj); ok {
+			return out, chain, nil, nil
+		}
+		var warnings []string
+		if path.Ext(manifestPath) != ".json" && hasComments(data) {
+			warnings = append(warnings, fmt.Sprintf("comments in %q are removed, as it has to be re-encoded", manifestPath))
+		}
+		var out []byte
+		if path.Ext(manifestPath) == ".json" {
+			out, err = json.MarshalIndent(obj, "", "  ")
+			out = append(out, '\n')
+		} else {
+			out, err = yaml.Marshal(obj)
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error encoding %q – %v", manifestPath, err)
+		}
+		return out, chain, warnings, nil
+	}
+
+	return nil, nil, nil, nil
+}
+
+// convertText applies conversions to YAML or JSON text as it is, it returns false if the result
+// is not the same as the converted object, so that the manifest gets re-encoded instead
+func convertText(data []byte, manifestPath string, chain []conversion, converted map[string]interface{}) ([]byte, bool) {
+	out := data
+	for _, c := range chain {
+		out = c.ConvertText(bytes.Replace(out, []byte(c.From), []byte(c.To), -1))
+	}
+
+	var v interface{}
+	if err := util.LoadObj(&v, out, manifestPath, ""); err != nil {
+		return nil, false
+	}
+	obj, err := normalise(v)
+	if err != nil || !reflect.DeepEqual(obj, converted) {
+		return nil, false
+	}
+	return out, true
+}
+
+// hasComments is a rough check for comments in YAML, as the parser doesn't keep these, a '#' in
+// a string is taken for a comment as well, which only means that a warning is shown needlessly
+func hasComments(data []byte) bool {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") || strings.Contains(line, " #") {
+			return true
+		}
+	}
+	return false
+}
+
+// upgradeManifest converts a manifest of an older version in memory, any other manifests are
+// returned as they are, and so are the ones that don't parse, as the error is reported when
+// the manifest gets loaded
+func upgradeManifest(data []byte, manifestPath string) ([]byte, error) {
+	var v interface{}
+	if err := util.LoadObj(&v, data, manifestPath, ""); err != nil {
+		return data, nil
+	}
+
+	out, chain, _, err := convertManifest(data, manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	if chain == nil {
+		return data, nil
+	}
+	return out, nil
+}
+
+// MigrateFile upgrades a manifest of an older version to the latest one and writes it in the same
+// format, it returns the versions converted from and to, or empty strings if the file didn't need
+// any conversion, along with warnings about anything that is lost in the conversion (i.e. comments)
+func MigrateFile(manifestPath string, dryRun bool) (string, string, []string, error) {
+	data, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("error reading file %q – %v", manifestPath, err)
+	}
+
+	out, chain, warnings, err := convertManifest(data, manifestPath)
+	if err != nil {
+		return "", "", nil, err
+	}
+	if chain == nil {
+		return "", "", nil, nil
+	}
+
+	from, to := chain[0].From, chain[len(chain)-1].To
+	if dryRun {
+		return from, to, warnings, nil
+	}
+
+	info, err := os.Stat(manifestPath)
+	if err != nil {
+		return "", "", nil, err
+	}
+	if err := ioutil.WriteFile(manifestPath, out, info.Mode()); err != nil {
+		return "", "", nil, fmt.Errorf("error writing to file %q – %v", manifestPath, err)
+	}
+	return from, to, warnings, nil
+}
+
+func findHCLKind(file *ast.File) *ast.LiteralType {
+	root, ok := file.Node.(*ast.ObjectList)
+	if !ok {
+		return nil
+	}
+	for _, item := range root.Items {
+		if len(item.Keys) == 1 && hclKey(item.Keys[0]) == "kind" {
+			if literal, ok := item.Val.(*ast.LiteralType); ok && literal.Token.Type == token.STRING {
+				return literal
+			}
+		}
+	}
+	return nil
+}
+
+// FindManifestFiles returns the given path if it's a file, or manifests in the given directory and any
+// of its sub-directories, which are found in the same way as when a module is loaded, so that files that
+// are ignored or excluded by the module index are not migrated
+func FindManifestFiles(p string) ([]string, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{p}, nil
+	}
+
+	return findManifests(path.Clean(p))
+}
@@ -0,0 +1,200 @@
+package modules
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrate(t *testing.T) {
+	files := map[string]string{
+		"app.yml": `
+Kind: kubegen.k8s.io/Module.v1alpha1
+Parameters:
+- { name: image, type: string, default: "app:1" }
+- { name: replicas, type: number, default: 1 }
+Deployments:
+- name: app
+  replicas: { kubegen.numbericValueFromParameter: replicas }
+  containers: [{ name: app, image: { kubegen.stringValueFromParameter: image } }]
+ConfigMaps:
+- name: app
+  data:
+    encodeAsJSON:
+      config.json: { replicas: { kubegen.numericValueFromParameter: replicas } }
+`,
+		"db.hcl": `
+kind = "kubegen.k8s.io/Module.v1alpha1"
+
+parameter "db_args" {
+  type = "string"
+  default = "--quiet"
+}
+
+deployment "db" {
+  container "db" {
+    image = "db"
+    args = [{ kubegen.stringValueFromParameter = "db_args" }]
+  }
+}
+`,
+		"raw/service.yml": `
+apiVersion: v1
+kind: Service
+metadata: { name: app }
+spec:
+  ports: [{ port: 80 }]
+`,
+		"ignored/app.yml": "Kind: kubegen.k8s.io/Module.v1alpha1\n",
+		"excluded.yml":    "Kind: kubegen.k8s.io/Module.v1alpha1\n",
+		"README.md":       "not a manifest\n",
+		".kubegenignore":  "ignored\n",
+		"kubegen-module.yml": `
+Kind: kubegen.k8s.io/ModuleIndex.v1alpha2
+Exclude: [excluded.yml]
+`,
+	}
+	dir := writeFiles(t, files)
+	defer os.RemoveAll(dir)
+
+	manifests, err := FindManifestFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		filepath.Join(dir, "app.yml"),
+		filepath.Join(dir, "db.hcl"),
+		filepath.Join(dir, "raw/service.yml"),
+	}, manifests)
+
+	manifests, err = FindManifestFiles(filepath.Join(dir, "excluded.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{filepath.Join(dir, "excluded.yml")}, manifests)
+
+	for _, manifest := range []string{"app.yml", "db.hcl"} {
+		p := filepath.Join(dir, manifest)
+
+		from, to, _, err := MigrateFile(p, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, ModuleKindV1alpha1, from)
+		assert.Equal(t, ModuleKind, to)
+		data, _ := ioutil.ReadFile(p)
+		assert.Equal(t, files[manifest], string(data), "dry run must not rewrite %q", manifest)
+
+		if _, _, _, err := MigrateFile(p, false); err != nil {
+			t.Fatal(err)
+		}
+		if from, _, _, err := MigrateFile(p, false); assert.NoError(t, err) {
+			assert.Empty(t, from, "%q must be up to date", manifest)
+		}
+	}
+
+	from, _, _, err := MigrateFile(filepath.Join(dir, "raw/service.yml"), false)
+	assert.NoError(t, err)
+	assert.Empty(t, from)
+	// the module doesn't include it as a raw resource
+	os.RemoveAll(filepath.Join(dir, "raw"))
+
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "db.hcl"))
+	assert.Contains(t, string(data), `kind = "`+ModuleKind+`"`)
+	assert.Regexp(t, `type\s+= "String"`, string(data))
+	assert.Contains(t, string(data), `kubegen.String.Lookup = "db_args"`)
+
+	bundle, err := loadBundle(ModuleInstance{Name: "app", SourceDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, err := generateObjects(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := findObject(objs, "Deployment", "app")
+	assert.Equal(t, "app:1", firstContainer(app)["image"])
+	assert.Equal(t, float64(1), app["spec"].(map[string]interface{})["replicas"])
+	configMap := findObject(objs, "ConfigMap", "app")
+	assert.Equal(t, map[string]interface{}{"config.json": `{"replicas":1}`}, configMap["data"])
+	db := findObject(objs, "Deployment", "db")
+	assert.Equal(t, []interface{}{"--quiet"}, firstContainer(db)["args"])
+}
+
+func TestMigrateComments(t *testing.T) {
+	tests := []struct {
+		manifest string
+		migrated string
+		warning  string
+	}{
+		{
+			// lookups and types are renamed in place, so comments and order of keys are kept
+			manifest: `# the app
+Kind: kubegen.k8s.io/Module.v1alpha1
+Parameters:
+- name: replicas # how many
+  type: number
+  default: 1
+Deployments:
+- name: app
+  # scaled by the parameter
+  replicas: { kubegen.numericValueFromParameter: replicas }
+  containers: [{ name: app, image: "app:1" }]
+`,
+			migrated: `# the app
+Kind: kubegen.k8s.io/Module.v1alpha2
+Parameters:
+- name: replicas # how many
+  type: Number
+  default: 1
+Deployments:
+- name: app
+  # scaled by the parameter
+  replicas: { kubegen.Number.Lookup: replicas }
+  containers: [{ name: app, image: "app:1" }]
+`,
+		},
+		{
+			// encodeAsJSON has to be restructured, so the manifest is re-encoded
+			manifest: `# the app
+Kind: kubegen.k8s.io/Module.v1alpha1
+ConfigMaps:
+- name: app
+  data:
+    encodeAsJSON:
+      config.json: { debug: true }
+`,
+			migrated: `ConfigMaps:
+- data:
+    config.json:
+      kubegen.String.AsJSON:
+        debug: true
+  name: app
+Kind: kubegen.k8s.io/Module.v1alpha2
+`,
+			warning: "comments in %q are removed, as it has to be re-encoded",
+		},
+	}
+
+	for _, test := range tests {
+		dir := writeFiles(t, map[string]string{"app.yml": test.manifest})
+		defer os.RemoveAll(dir)
+		p := filepath.Join(dir, "app.yml")
+
+		_, _, warnings, err := MigrateFile(p, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.warning == "" {
+			assert.Empty(t, warnings)
+		} else {
+			assert.Equal(t, []string{fmt.Sprintf(test.warning, p)}, warnings)
+		}
+		data, _ := ioutil.ReadFile(p)
+		assert.Equal(t, test.migrated, string(data))
+	}
+}
@@ -1,17 +1,26 @@
 package modules
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 
 	"io/ioutil"
+	"math"
 	"os"
 	"path"
+	"reflect"
+	"regexp"
 	"sort"
 	"strings"
+	"text/tabwriter"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/errordeveloper/kubegen/pkg/macroproc"
 	"github.com/errordeveloper/kubegen/pkg/resources"
 	"github.com/errordeveloper/kubegen/pkg/util"
+	"github.com/errordeveloper/kubegen/pkg/version"
 )
 
 func (i *Module) makeLookupModifier(c *macroproc.Converter, branch *macroproc.BranchLocator, _ *macroproc.Macro) (macroproc.ModifierCallback, error) {
@@ -40,9 +49,73 @@ func (i *Module) makeLookupModifier(c *macroproc.Converter, branch *macroproc.Br
 	return c.TypeCheckModifier(branch, macroproc.String, cb)
 }
 
-func loadObjWithModuleContext(obj interface{}, data []byte, sourcePath string, instanceName string, moduleContext *Module) error {
+func (i *Module) makeForEachModifier(c *macroproc.Converter, branch *macroproc.BranchLocator, _ *macroproc.Macro) (macroproc.ModifierCallback, error) {
+	cb := func(m *macroproc.Modifier, c *macroproc.Converter) error {
+		// templates are instantiated from the outside in, so that nested
+		// iterations can refer to elements bound by the outer ones
+		if m.Branch.IsNestedIn(m.Macro) {
+			return nil
+		}
+		f, err := macroproc.NewForEach(m.Branch)
+		if err != nil {
+			return err
+		}
+		v, ok := i.attributes[f.In]
+		if !ok {
+			return fmt.Errorf("undeclared attribute %q", f.In)
+		}
+		// only literal arrays can be iterated over, so it's always bounded
+		items, ok := v.Value.([]interface{})
+		if !ok || !macroproc.IsLiteral(items) {
+			return fmt.Errorf("attribute %q is not a literal array", f.In)
+		}
+		result := make([]interface{}, 0, len(items))
+		for n, item := range items {
+			bindings := make(map[string]string)
+			if bindings[f.As], err = i.bindTemporaryAttribute(f.As, item); err != nil {
+				return err
+			}
+			if f.Index != "" {
+				if bindings[f.Index], err = i.bindTemporaryAttribute(f.Index, n); err != nil {
+					return err
+				}
+			}
+			result = append(result, f.Instantiate(bindings))
+		}
+		return c.Splice(m.Branch, result)
+	}
+	return c.TypeCheckModifier(branch, macroproc.Object, cb)
+}
+
+func (i *Module) bindTemporaryAttribute(name string, value interface{}) (AttributeKey, error) {
+	if v, ok := i.attributes[name]; ok {
+		return "", fmt.Errorf("cannot bind %q (attribute already defined as %q)", name, v.Kind)
+	}
+	k := fmt.Sprintf("%s#%d", name, len(i.temporaryAttributes))
+	i.attributes[k] = attribute{
+		Value: value,
+		Kind:  "temporary",
+	}
+	i.temporaryAttributes = append(i.temporaryAttributes, k)
+	return k, nil
+}
+
+func (i *Module) unbindTemporaryAttributes() {
+	for _, k := range i.temporaryAttributes {
+		delete(i.attributes, k)
+	}
+	i.temporaryAttributes = nil
+}
+
+func newConverterWithModuleContext(moduleContext *Module) *macroproc.Converter {
 	mp := macroproc.New()
 
+	if len(moduleContext.MergeKeys) > 0 {
+		mp.SetMergeKeys(moduleContext.MergeKeys...)
+	}
+
+	mp.DefineMacro(macroproc.MacroArrayForEach, moduleContext.makeForEachModifier)
+
 	mp.DefineMacro(macroproc.MacroStringLookup, moduleContext.makeLookupModifier)
 	mp.DefineMacro(macroproc.MacroNumberLookup, moduleContext.makeLookupModifier)
 	mp.DefineMacro(macroproc.MacroObjectLookup, moduleContext.makeLookupModifier)
@@ -53,6 +126,14 @@ func loadObjWithModuleContext(obj interface{}, data []byte, sourcePath string, i
 	mp.DefineMacro(macroproc.MacroStringAsYAML, macroproc.MakeModifierStringAsYAML)
 	mp.DefineMacro(macroproc.MacroStringAsBASE64, macroproc.MakeModifierStringAsBASE64)
 
+	return mp
+}
+
+func loadObjWithModuleContext(obj interface{}, data []byte, sourcePath string, instanceName string, moduleContext *Module) error {
+	mp := newConverterWithModuleContext(moduleContext)
+
+	defer moduleContext.unbindTemporaryAttributes()
+
 	if err := mp.LoadObject(data, sourcePath, instanceName); err != nil {
 		return err
 	}
@@ -65,7 +146,38 @@ func loadObjWithModuleContext(obj interface{}, data []byte, sourcePath string, i
 	return nil
 }
 
+// evalWithModuleContext evaluates any macros in a value, which is wrapped in an object,
+// as macros cannot be evaluated at the top-level
+func evalWithModuleContext(value interface{}, moduleContext *Module) (interface{}, error) {
+	mp := newConverterWithModuleContext(moduleContext)
+
+	defer moduleContext.unbindTemporaryAttributes()
+
+	data, err := json.Marshal(map[string]interface{}{"Kind": ModuleKind, "value": value})
+	if err != nil {
+		return nil, err
+	}
+	if err := mp.LoadJSON(data); err != nil {
+		return nil, err
+	}
+	if err := mp.Run(); err != nil {
+		return nil, err
+	}
+	if data, err = mp.MarshalJSON(); err != nil {
+		return nil, err
+	}
+	obj := make(map[string]interface{})
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	return obj["value"], nil
+}
+
 func NewBundle(bundlePath string) (*Bundle, error) {
+	return newBundle(bundlePath, nil)
+}
+
+func newBundle(bundlePath string, extendedBy []string) (*Bundle, error) {
 	b := &Bundle{path: bundlePath}
 
 	data, err := ioutil.ReadFile(bundlePath)
@@ -75,6 +187,11 @@ func NewBundle(bundlePath string) (*Bundle, error) {
 			bundlePath, err)
 	}
 
+	// older versions are converted to the latest one in memory
+	if data, err = upgradeManifest(data, bundlePath); err != nil {
+		return nil, err
+	}
+
 	if err := util.LoadObj(b, data, bundlePath, ""); err != nil {
 		return nil, err
 	}
@@ -84,12 +201,20 @@ func NewBundle(bundlePath string) (*Bundle, error) {
 			bundlePath, b.Kind, BundleKind)
 	}
 
+	if b.Extends != "" {
+		if err := b.resolveExtends(extendedBy); err != nil {
+			return nil, err
+		}
+	}
+
 	return b, nil
 }
 
 func (b *Bundle) LoadModules(selectNames []string) error {
 	applyNameSelector := len(selectNames) > 0
+	b.selectedModulesOnly = applyNameSelector
 
+	instances := []ModuleInstance{}
 	for n, i := range b.Modules {
 		if applyNameSelector {
 			skip := true
@@ -103,27 +228,114 @@ func (b *Bundle) LoadModules(selectNames []string) error {
 			}
 		}
 
-		var err error
-		m, err := NewModule(path.Join(path.Dir(b.path), i.SourceDir), i.Name)
-		if err != nil {
-			return err
-		}
-
 		// Local namespace overrides global namespace if set
 		if i.Namespace == "" && b.Namespace != "" {
 			b.Modules[n].Namespace = b.Namespace
+			i.Namespace = b.Namespace
+		}
+
+		// Common labels and annotations of the bundle are added to those of the instance
+		i.CommonLabels = util.MergeStringMaps(b.CommonLabels, i.CommonLabels)
+		i.CommonAnnotations = util.MergeStringMaps(b.CommonAnnotations, i.CommonAnnotations)
+		i.CommonLabelsInSelectors = i.CommonLabelsInSelectors || b.CommonLabelsInSelectors
+
+		// Image overrides of the instance take precedence over those of the bundle
+		i.Images = mergeImageOverrides(b.Images, i.Images)
+		for _, o := range i.Images {
+			if err := o.validate(); err != nil {
+				return fmt.Errorf("error in module %q – %v", i.Name, err)
+			}
+		}
+
+		// Bundle parameters are inherited, unless the instance sets its own value, or the value
+		// refers to outputs of the instance itself (as these are meant for the other instances)
+		if len(b.Parameters) > 0 {
+			parameters := make(map[string]interface{}, len(b.Parameters)+len(i.Parameters))
+			i.parameterSources = make(map[string]string, len(parameters))
+			for k, v := range b.Parameters {
+				if refersToModuleOutputs(v, i.Name) {
+					continue
+				}
+				parameters[k] = v
+				i.parameterSources[k] = "bundle"
+			}
+			for k, v := range i.Parameters {
+				parameters[k] = v
+				i.parameterSources[k] = "instance"
+			}
+			i.Parameters = parameters
+		}
+
+		instances = append(instances, i)
+	}
+
+	// instances that use outputs of other instances have to be loaded after those
+	instances, err := sortModuleInstances(instances)
+	if err != nil {
+		return err
+	}
+
+	outputs := make(map[string]map[string]interface{})
+	for _, i := range instances {
+		if err := i.resolveModuleOutputs(outputs); err != nil {
+			return err
 		}
 
-		if err := m.LoadAttributes(i); err != nil {
+		dir, source, err := moduleSourceDir(i, path.Dir(b.path))
+		if err != nil {
 			return err
 		}
 
-		if err := m.IncludeResouces(i); err != nil {
+		m, err := NewModule(dir, i.Name)
+		if err != nil {
 			return err
 		}
+		m.source = source
 
-		b.loadedModules = append(b.loadedModules, *m)
-		//log.Printf("Added module with %d manifests", len(m.manifests))
+		if err := b.loadModule(m, i, nil); err != nil {
+			return err
+		}
+
+		outputs[i.Name] = m.outputs
+	}
+
+	return b.checkUndeclaredParameters()
+}
+
+// loadModule adds the module along with any of its sub-modules, includedBy holds
+// source directories of the parent modules, so that a cycle can be detected
+func (b *Bundle) loadModule(m *Module, instance ModuleInstance, includedBy []string) error {
+	m.allowUndeclaredParameters = b.allowUndeclaredParameters
+	m.provenanceAnnotations = b.provenanceAnnotations
+	m.omitVersion = b.omitVersion
+	m.yamlStyle = b.yamlStyle
+	m.jsonStyle = b.jsonStyle
+	if err := m.LoadAttributes(instance); err != nil {
+		return err
+	}
+
+	if err := m.IncludeResouces(instance); err != nil {
+		return err
+	}
+
+	if err := m.loadOutputs(); err != nil {
+		return err
+	}
+
+	b.loadedModules = append(b.loadedModules, *m)
+	//log.Printf("Added module with %d manifests", len(m.manifests))
+
+	includedBy = append(append([]string{}, includedBy...), m.directory)
+
+	subModules, err := m.loadSubModules(includedBy)
+	if err != nil {
+		return err
+	}
+
+	for n := range subModules {
+		if err := b.loadModule(subModules[n], subModules[n].instance, includedBy); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -131,45 +343,140 @@ func (b *Bundle) LoadModules(selectNames []string) error {
 
 func (b *Bundle) WriteToOutputDir(contentType string) ([]string, error) {
 	filesWritten := []string{}
+	// output directory can be shared by a few module instances
+	generatedFiles := make(map[string][]string)
+	outputDirs := []string{}
 
-	for n, i := range b.loadedModules {
-		var (
-			groups map[string][]byte
-			err    error
-		)
-		switch contentType {
-		case "yaml":
-			groups, err = i.EncodeGroupsToYAML(b.Modules[n])
-		case "json":
-			groups, err = i.EncodeGroupsToJSON(b.Modules[n])
-		}
+	for n := range b.loadedModules {
+		i := &b.loadedModules[n]
+
+		files, err := i.encodeFiles(i.instance, contentType, b.outputLayout)
 		if err != nil {
 			return nil, err
 		}
 
-		dir := b.Modules[n].OutputDir
+		dir := i.instance.OutputDir
 
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return nil, fmt.Errorf("error creating output directory %q – %v", dir, err)
 		}
+		if _, ok := generatedFiles[dir]; !ok {
+			generatedFiles[dir] = []string{}
+			outputDirs = append(outputDirs, dir)
+		}
+
+		filenames := []string{}
+		for filename := range files {
+			filenames = append(filenames, filename)
+		}
+		sort.Strings(filenames)
 
-		for manifestPath, group := range groups {
-			outputFilename := path.Join(dir, strings.TrimSuffix(path.Base(manifestPath), path.Ext(manifestPath))+"."+contentType)
-			if err := ioutil.WriteFile(outputFilename, group, 0644); err != nil {
+		for _, filename := range filenames {
+			outputFilename := path.Join(dir, filename)
+			if err := os.MkdirAll(path.Dir(outputFilename), 0755); err != nil {
+				return nil, fmt.Errorf("error creating output directory %q – %v", path.Dir(outputFilename), err)
+			}
+			if err := ioutil.WriteFile(outputFilename, files[filename], 0644); err != nil {
 				return nil, fmt.Errorf("error writing to file %q – %v", outputFilename, err)
 			}
 			filesWritten = append(filesWritten, outputFilename)
+			generatedFiles[dir] = append(generatedFiles[dir], filename)
+		}
+	}
+
+	for _, dir := range outputDirs {
+		if err := b.recordGeneratedFiles(dir, generatedFiles[dir]); err != nil {
+			return nil, err
 		}
 	}
 
 	return filesWritten, nil
 }
 
+// Explain shows values of parameters in each of the module instances,
+// and where the value came from (a bundle, an instance or a default)
+func (b *Bundle) Explain() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := tabwriter.NewWriter(buf, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintf(w, "MODULE\tPARAMETER\tVALUE\tSOURCE\n")
+	for _, m := range b.loadedModules {
+		names := []string{}
+		for k, v := range m.attributes {
+			if v.Kind == "parameter" {
+				names = append(names, k)
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			v := m.attributes[name]
+			value := formatValue(v.Value)
+			if v.Sensitive {
+				value = util.Redacted
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", m.instance.Name, name, value, v.Source)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Warnings returns any issues that were found while generating the resources, but
+// don't prevent it, e.g. image overrides that did not match any of the containers,
+// or parameters that are not declared by the module, when these are allowed
+func (b *Bundle) Warnings() []string {
+	usedBy := make(map[string][]string)
+	matched := make(map[string]bool)
+	for _, m := range b.loadedModules {
+		for _, o := range m.instance.Images {
+			usedBy[o.Name] = append(usedBy[o.Name], m.instance.Name)
+			if m.matchedImages[o.Name] {
+				matched[o.Name] = true
+			}
+		}
+	}
+
+	names := []string{}
+	for name := range usedBy {
+		if !matched[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	warnings := []string{}
+	for _, m := range b.loadedModules {
+		for _, problem := range m.undeclaredParameters {
+			warnings = append(warnings, util.RedactString(problem, m.sensitiveValues()))
+		}
+	}
+	warnings = append(warnings, b.undeclaredParameters...)
+	for _, name := range names {
+		warnings = append(warnings, fmt.Sprintf(
+			"image override %q did not match any containers in modules [%s]",
+			name, strings.Join(usedBy[name], ", ")))
+	}
+	for _, m := range b.loadedModules {
+		warnings = append(warnings, m.renameWarnings...)
+	}
+	return warnings
+}
+
+// MaskSensitiveValues enables masking of sensitive parameter values in
+// all objects other than Secrets returned by EncodeAllToYAML and EncodeAllToJSON
+func (b *Bundle) MaskSensitiveValues() { b.maskSensitiveValues = true }
+
 func (b *Bundle) EncodeAllToYAML() ([]byte, error) {
 	output := []byte{}
 
-	for n, i := range b.loadedModules {
-		groups, err := i.EncodeGroupsToYAML(b.Modules[n])
+	for n := range b.loadedModules {
+		i := &b.loadedModules[n]
+		i.maskSensitiveValues = b.maskSensitiveValues
+		groups, err := i.EncodeGroupsToYAML(i.instance)
 		if err != nil {
 			return nil, err
 		}
@@ -192,8 +499,10 @@ func (b *Bundle) EncodeAllToYAML() ([]byte, error) {
 func (b *Bundle) EncodeAllToJSON() ([]byte, error) {
 	output := []byte{}
 
-	for n, i := range b.loadedModules {
-		groups, err := i.EncodeGroupsToJSON(b.Modules[n])
+	for n := range b.loadedModules {
+		i := &b.loadedModules[n]
+		i.maskSensitiveValues = b.maskSensitiveValues
+		groups, err := i.EncodeGroupsToJSON(i.instance)
 		if err != nil {
 			return nil, err
 		}
@@ -214,7 +523,7 @@ func (b *Bundle) EncodeAllToJSON() ([]byte, error) {
 }
 
 func NewModule(dir, instanceName string) (*Module, error) {
-	files, err := ioutil.ReadDir(dir)
+	manifestPaths, err := findManifests(dir)
 	if err != nil {
 		return nil, err
 	}
@@ -224,37 +533,98 @@ func NewModule(dir, instanceName string) (*Module, error) {
 		manifests: make(map[ManifestPath][]byte),
 		resources: make(map[ManifestPath][]resources.Anything),
 	}
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
+
+	// any errors are deferred, because some of the files may turn out to be resources
+	// included by other manifests, or belong to sub-modules in nested directories
+	loaded := make(map[ManifestPath]*Module, len(manifestPaths))
+	errors := make(map[ManifestPath]error)
+	data := make(map[ManifestPath][]byte, len(manifestPaths))
+	for _, manifestPath := range manifestPaths {
 		// TODO consolidate with NewResourceGroupFromFile
 		m := &Module{}
-		manifestPath := path.Join(dir, file.Name())
-		data, err := ioutil.ReadFile(manifestPath)
-		if err != nil {
+		if data[manifestPath], err = ioutil.ReadFile(manifestPath); err != nil {
 			return nil, fmt.Errorf(
 				"error reading file %q in module %q – %v",
-				file.Name(), dir, err)
+				module.relativePath(manifestPath), dir, err)
 		}
-		if err := util.LoadObj(m, data, manifestPath, instanceName); err != nil {
-			return nil, err
+		// older versions are converted to the latest one in memory
+		if data[manifestPath], err = upgradeManifest(data[manifestPath], manifestPath); err != nil {
+			errors[manifestPath] = err
+			continue
+		}
+		if err := util.LoadObj(m, data[manifestPath], manifestPath, instanceName); err != nil {
+			errors[manifestPath] = err
+			continue
 		}
 		if m.Kind != ModuleKind {
-			return nil, fmt.Errorf(
+			errors[manifestPath] = fmt.Errorf(
 				"error loading file %q in module %q – unrecognised `Kind: %q`, must be %q",
-				file.Name(), dir, m.Kind, ModuleKind)
+				module.relativePath(manifestPath), dir, m.Kind, ModuleKind)
+			continue
 		}
+		loaded[manifestPath] = m
+	}
+
+	skip := func(manifestPath ManifestPath) bool {
+		for _, m := range loaded {
+			for _, resource := range m.Resources {
+				if path.Join(dir, resource.Path) == manifestPath {
+					return true
+				}
+			}
+			for _, instance := range m.Modules {
+				// a module that includes its own directory is caught as a cycle later on
+				subModuleDir := path.Join(dir, instance.SourceDir)
+				if instance.SourceDir != "" && subModuleDir != path.Clean(dir) && strings.HasPrefix(manifestPath, subModuleDir+"/") {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	var mergeKeysDeclaredIn ManifestPath
+	for _, manifestPath := range manifestPaths {
+		if skip(manifestPath) {
+			continue
+		}
+		if err, ok := errors[manifestPath]; ok {
+			return nil, err
+		}
+		m := loaded[manifestPath]
 		// Parameters and Internals are scoped globally, here we collect them
-		module.Parameters = append(module.Parameters, m.Parameters...)
-		module.Internals = append(module.Internals, m.Internals...)
+		for _, parameter := range m.Parameters {
+			parameter.declaredIn = manifestPath
+			module.Parameters = append(module.Parameters, parameter)
+		}
+		for _, internal := range m.Internals {
+			internal.declaredIn = manifestPath
+			module.Internals = append(module.Internals, internal)
+		}
+		for _, instance := range m.Modules {
+			instance.includedBy = manifestPath
+			module.Modules = append(module.Modules, instance)
+		}
+		for _, output := range m.Outputs {
+			output.declaredIn = manifestPath
+			module.Outputs = append(module.Outputs, output)
+		}
+		if len(m.MergeKeys) > 0 {
+			if len(module.MergeKeys) > 0 && strings.Join(module.MergeKeys, ",") != strings.Join(m.MergeKeys, ",") {
+				return nil, fmt.Errorf(
+					"error loading file %q in module %q – `MergeKeys` %q differ from %q set in %q, these must be the same in all manifests",
+					module.relativePath(manifestPath), dir, m.MergeKeys, module.MergeKeys, module.relativePath(mergeKeysDeclaredIn))
+			}
+			module.MergeKeys = m.MergeKeys
+			mergeKeysDeclaredIn = manifestPath
+		}
 		// Append raw resources that will be loaded separately
 		for _, resource := range m.Resources {
 			resource.includedBy = manifestPath
 			module.Resources = append(module.Resources, resource)
 		}
 		// The module itself isn't something we can parse 100% yet, so we only store it as a string
-		module.manifests[manifestPath] = data
+		module.manifests[manifestPath] = data[manifestPath]
 	}
 
 	return module, nil
@@ -266,13 +636,23 @@ func (i *ModuleParameter) load(m *Module, instance ModuleInstance) error {
 		instance.Name, i.Name, i.Type)
 
 	unknownParameterTypeError := fmt.Errorf(
-		"parameter %q in module %q of unknown type %q, only types \"String\" and \"Number\" are supported",
+		"parameter %q in module %q of unknown type %q, only types \"String\", \"Number\" and \"Array\" are supported",
 		i.Name, instance.Name, i.Type)
 
 	wrongParameterTypeError := func(v interface{}) error {
+		hint := ""
+		switch v.(type) {
+		case float64, int, bool:
+			if i.Type == "String" {
+				hint = " – a value that looks like a number or a boolean has to be quoted to be a string"
+			}
+		}
+		if i.Sensitive {
+			v = util.Redacted
+		}
 		return fmt.Errorf(
-			"parameter %q in module %q not of type %q [value: %#v]",
-			i.Name, instance.Name, i.Type, v)
+			"parameter %q in module %q not of type %q [value: %#v]%s",
+			i.Name, instance.Name, i.Type, v, hint)
 	}
 
 	defaultValueNotSetError := fmt.Errorf(
@@ -284,51 +664,56 @@ func (i *ModuleParameter) load(m *Module, instance ModuleInstance) error {
 			i.Name, instance.Name, v.Kind)
 	}
 
+	source := "default"
+	if _, isSet := instance.Parameters[i.Name]; isSet {
+		source = "instance"
+		if s, ok := instance.parameterSources[i.Name]; ok {
+			source = s
+		}
+	}
+
 	switch i.Type {
 	case "Number":
-		// all numeric values from YAML are parsed as float64, but Kubernetes API mostly wants int32
-		var value int32
+		// all numeric values from YAML are parsed as float64, but Kubernetes API mostly wants int32,
+		// so constraints are checked on the original value and only whole numbers that fit are converted
 		v, isSet := instance.Parameters[i.Name]
 		// TODO how can we safely detect if default value is set and derive whether this is optional or not from that?
-		if i.Required {
-			if isSet {
-				switch v.(type) {
-				case float64:
-					value = int32(v.(float64))
-				case int:
-					value = int32(v.(int))
-				default:
-					return wrongParameterTypeError(v)
-				}
-			} else {
+		if !isSet {
+			if i.Required {
 				return undefinedNonOptionalParameterError
 			}
-		} else {
-			if isSet {
-				switch v.(type) {
-				case float64:
-					value = int32(v.(float64))
-				case int:
-					value = int32(v.(int))
-				default:
-					return wrongParameterTypeError(v)
-				}
-			} else {
-				if i.Default == nil {
-					return defaultValueNotSetError
-				}
-				switch i.Default.(type) {
-				case string:
-					value = int32(i.Default.(float64))
-				default:
-					return wrongParameterTypeError(v)
-				}
+			if i.Default == nil {
+				return defaultValueNotSetError
+			}
+			v = i.Default
+		}
+		var number float64
+		switch v.(type) {
+		case float64:
+			number = v.(float64)
+		case int:
+			number = float64(v.(int))
+		default:
+			return wrongParameterTypeError(v)
+		}
+		if err := i.checkConstraints(instance, number); err != nil {
+			return err
+		}
+		if number != math.Trunc(number) || number < math.MinInt32 || number > math.MaxInt32 {
+			if i.Sensitive {
+				v = util.Redacted
 			}
+			return fmt.Errorf(
+				"parameter %q in module %q of type %q must be a whole number between %d and %d [value: %#v]",
+				i.Name, instance.Name, i.Type, math.MinInt32, math.MaxInt32, v)
 		}
+		value := int32(number)
 		m.attributes[i.Name] = attribute{
-			Type:  i.Type,
-			Value: value,
-			Kind:  "parameter",
+			Type:      i.Type,
+			Value:     value,
+			Kind:      "parameter",
+			Sensitive: i.Sensitive,
+			Source:    source,
 		}
 		return nil
 	case "String":
@@ -362,14 +747,53 @@ func (i *ModuleParameter) load(m *Module, instance ModuleInstance) error {
 				case string:
 					value = i.Default.(string)
 				default:
-					return wrongParameterTypeError(v)
+					return wrongParameterTypeError(i.Default)
 				}
 			}
 		}
+		if err := i.checkConstraints(instance, value); err != nil {
+			return err
+		}
 		m.attributes[i.Name] = attribute{
-			Type:  i.Type,
-			Value: value,
-			Kind:  "parameter",
+			Type:      i.Type,
+			Value:     value,
+			Kind:      "parameter",
+			Sensitive: i.Sensitive,
+			Source:    source,
+		}
+		return nil
+	case "Array":
+		// only literal arrays are accepted, so that iteration with kubegen.Array.ForEach is always bounded
+		var value []interface{}
+		v, isSet := instance.Parameters[i.Name]
+		if !isSet {
+			if i.Required {
+				return undefinedNonOptionalParameterError
+			}
+			if i.Default == nil {
+				return defaultValueNotSetError
+			}
+			v = i.Default
+		}
+		switch v.(type) {
+		case []interface{}:
+			value = v.([]interface{})
+		default:
+			return wrongParameterTypeError(v)
+		}
+		if !macroproc.IsLiteral(value) {
+			return fmt.Errorf("parameter %q in module %q of type %q must be a literal array, it cannot contain any macros",
+				i.Name, instance.Name, i.Type)
+		}
+		if err := i.checkConstraints(instance, value); err != nil {
+			return err
+		}
+		m.attributes[i.Name] = attribute{
+			Type:      i.Type,
+			Value:     value,
+			Kind:      "parameter",
+			Sensitive: i.Sensitive,
+			Source:    source,
 		}
 		return nil
 	default:
@@ -377,21 +801,204 @@ func (i *ModuleParameter) load(m *Module, instance ModuleInstance) error {
 	}
 }
 
+func (i *ModuleParameter) checkConstraints(instance ModuleInstance, value interface{}) error {
+	constraintError := func(format string, args ...interface{}) error {
+		var v interface{} = value
+		if i.Sensitive {
+			v = util.Redacted
+		}
+		return fmt.Errorf(
+			"parameter %q in module %q does not satisfy constraint – %s [value: %#v]",
+			i.Name, instance.Name, fmt.Sprintf(format, args...), v)
+	}
+
+	invalidConstraintError := func(format string, args ...interface{}) error {
+		return fmt.Errorf(
+			"parameter %q in module %q has invalid constraint – %s",
+			i.Name, instance.Name, fmt.Sprintf(format, args...))
+	}
+
+	if len(i.Enum) > 0 && !isOneOf(value, i.Enum) {
+		return constraintError("must be one of %v", i.Enum)
+	}
+
+	switch value.(type) {
+	case string:
+		if i.Min != nil || i.Max != nil {
+			return invalidConstraintError("`min` and `max` only apply to parameters of type \"Number\"")
+		}
+		if i.Pattern != "" {
+			// pattern has to match the whole value, as one would normally expect
+			re, err := regexp.Compile("^(?:" + i.Pattern + ")$")
+			if err != nil {
+				return invalidConstraintError("`pattern` is not a valid regular expression – %v", err)
+			}
+			if !re.MatchString(value.(string)) {
+				return constraintError("must match pattern %q", i.Pattern)
+			}
+		}
+		if err := i.checkLength(len(value.(string)), constraintError); err != nil {
+			return err
+		}
+	case []interface{}:
+		if i.Min != nil || i.Max != nil || i.Pattern != "" {
+			return invalidConstraintError("`min`, `max` and `pattern` don't apply to arrays")
+		}
+		if err := i.checkLength(len(value.([]interface{})), constraintError); err != nil {
+			return err
+		}
+	case float64:
+		if i.Pattern != "" || i.MinLength != nil || i.MaxLength != nil {
+			return invalidConstraintError("`pattern`, `minLength` and `maxLength` don't apply to parameters of type \"Number\"")
+		}
+		n := value.(float64)
+		if i.Min != nil && n < *i.Min {
+			return constraintError("must be no less than %v", *i.Min)
+		}
+		if i.Max != nil && n > *i.Max {
+			return constraintError("must be no greater than %v", *i.Max)
+		}
+	}
+
+	return nil
+}
+
+// isOneOf compares values of the same type only, so that e.g. "1" doesn't match 1
+func isOneOf(value interface{}, values []interface{}) bool {
+	for _, v := range values {
+		switch value.(type) {
+		case float64:
+			// numbers are parsed as float64, except for integers in HCL
+			switch v.(type) {
+			case float64:
+				if v.(float64) == value.(float64) {
+					return true
+				}
+			case int:
+				if float64(v.(int)) == value.(float64) {
+					return true
+				}
+			}
+		default:
+			if reflect.DeepEqual(v, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (i *ModuleParameter) checkLength(length int, constraintError func(string, ...interface{}) error) error {
+	if i.MinLength != nil && length < *i.MinLength {
+		return constraintError("length must be no less than %d", *i.MinLength)
+	}
+	if i.MaxLength != nil && length > *i.MaxLength {
+		return constraintError("length must be no greater than %d", *i.MaxLength)
+	}
+	return nil
+}
+
 func (i *ModuleInternal) load(m *Module, instance ModuleInstance) error {
 	if v, ok := m.attributes[i.Name]; ok {
 		return fmt.Errorf("cannot declare internal %q in module %q (attribute already defined as %q), already defined",
 			i.Name, instance.Name, v.Kind)
 	}
 
+	value, err := evalWithModuleContext(i.Value, m)
+	if err != nil {
+		return fmt.Errorf("error evaluating internal %q in module %q – %v", i.Name, instance.Name, err)
+	}
+
 	m.attributes[i.Name] = attribute{
 		Type:  i.Type,
-		Value: i.Value,
+		Value: value,
 		Kind:  "internal",
 	}
 
 	return nil
 }
 
+func isLookupMacro(key string) bool {
+	return strings.HasPrefix(key, "kubegen.") && strings.HasSuffix(key, ".Lookup")
+}
+
+// lookups returns names of all attributes the value refers to
+func lookups(v interface{}) []string {
+	names := []string{}
+	switch v.(type) {
+	case map[string]interface{}:
+		for k, x := range v.(map[string]interface{}) {
+			if name, ok := x.(string); ok && isLookupMacro(k) {
+				names = append(names, name)
+				continue
+			}
+			if name, ok := x.(string); ok && k == "in" {
+				// it may be an argument of kubegen.Array.ForEach
+				names = append(names, name)
+				continue
+			}
+			names = append(names, lookups(x)...)
+		}
+	case []interface{}:
+		for _, x := range v.([]interface{}) {
+			names = append(names, lookups(x)...)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortInternals orders internals so that each of them comes after the ones it refers to
+func sortInternals(internals []ModuleInternal, instanceName string) ([]ModuleInternal, error) {
+	index := make(map[string]int, len(internals))
+	for n, i := range internals {
+		index[i.Name] = n
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(internals))
+	sorted := make([]ModuleInternal, 0, len(internals))
+	chain := []string{}
+
+	var visit func(n int) error
+	visit = func(n int) error {
+		switch state[n] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("cyclic references between internals in module %q [%s]",
+				instanceName, strings.Join(append(chain, internals[n].Name), " → "))
+		}
+		state[n] = visiting
+		chain = append(chain, internals[n].Name)
+		for _, name := range lookups(internals[n].Value) {
+			if d, ok := index[name]; ok && d != n {
+				if err := visit(d); err != nil {
+					return err
+				}
+			} else if ok {
+				return fmt.Errorf("internal %q in module %q refers to itself", name, instanceName)
+			}
+		}
+		chain = chain[:len(chain)-1]
+		state[n] = visited
+		sorted = append(sorted, internals[n])
+		return nil
+	}
+
+	for n := range internals {
+		if err := visit(n); err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
+
 func (i *AnyResource) load(m *Module, instance ModuleInstance) error {
 	var obj interface{}
 	manifestPath := path.Join(m.directory, i.Path)
@@ -414,18 +1021,67 @@ func (i *AnyResource) load(m *Module, instance ModuleInstance) error {
 	return nil
 }
 
+func (m *Module) sensitiveValues() []string {
+	values := append([]string{}, m.inheritedSensitiveValues...)
+	for _, v := range m.attributes {
+		if !v.Sensitive {
+			continue
+		}
+		if items, ok := v.Value.([]interface{}); ok {
+			for _, item := range items {
+				values = append(values, fmt.Sprintf("%v", item))
+			}
+			continue
+		}
+		values = append(values, fmt.Sprintf("%v", v.Value))
+	}
+	return values
+}
+
+// redactError makes sure none of the sensitive values get into error messages,
+// as these may come from anywhere, it's simplest to check the final message
+func (m *Module) redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	values := m.sensitiveValues()
+	if len(values) == 0 {
+		return err
+	}
+	return fmt.Errorf("%s", util.RedactString(err.Error(), values))
+}
+
+func (m *Module) maskSensitiveValuesInOutput(contentType string, data []byte, pretty bool) ([]byte, error) {
+	values := m.sensitiveValues()
+	if !m.maskSensitiveValues || len(values) == 0 {
+		return data, nil
+	}
+	return util.MaskValues(contentType, data, pretty, values)
+}
+
 func (m *Module) LoadAttributes(instance ModuleInstance) error {
+	m.instance = instance
 	m.attributes = make(map[AttributeKey]attribute, len(m.Parameters))
 
 	for _, parameter := range m.Parameters {
 		if err := parameter.load(m, instance); err != nil {
-			return err
+			return m.redactError(err)
 		}
 	}
 
-	for _, internal := range m.Internals {
+	if err := m.checkUndeclaredParameters(instance); err != nil {
+		return m.redactError(err)
+	}
+
+	// internals may refer to parameters as well as other internals
+	internals, err := sortInternals(m.Internals, instance.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, internal := range internals {
 		if err := internal.load(m, instance); err != nil {
-			return err
+			return m.redactError(err)
 		}
 	}
 
@@ -435,13 +1091,110 @@ func (m *Module) LoadAttributes(instance ModuleInstance) error {
 func (m *Module) IncludeResouces(instance ModuleInstance) error {
 	for _, resource := range m.Resources {
 		if err := resource.load(m, instance); err != nil {
-			return err
+			return m.redactError(err)
 		}
 	}
 	// log.Printf("resources=%v", m.Resources)
 	return nil
 }
 
+// evalManifest evaluates all macros in the manifest, so that values of any of the
+// module fields can be obtained
+func (m *Module) evalManifest(manifestPath ManifestPath) (*Module, error) {
+	// evalue macros agains context of the current module
+	obj := &Module{}
+	if err := loadObjWithModuleContext(obj, m.manifests[manifestPath], manifestPath, m.instance.Name, m); err != nil {
+		return nil, m.redactError(err)
+	}
+	return obj, nil
+}
+
+// MaxModuleDepth limits how deep modules can be nested in one another
+const MaxModuleDepth = 8
+
+// loadSubModules creates instances of modules declared in this module, parameters of these
+// instances are evaluated against attributes of this module, however sub-modules cannot lookup
+// any attributes of this module, so that each module has its own scope
+func (m *Module) loadSubModules(includedBy []string) ([]*Module, error) {
+	manifestPaths := []ManifestPath{}
+	for _, instance := range m.Modules {
+		if len(manifestPaths) == 0 || manifestPaths[len(manifestPaths)-1] != instance.includedBy {
+			manifestPaths = append(manifestPaths, instance.includedBy)
+		}
+	}
+
+	subModules := []*Module{}
+	for _, manifestPath := range manifestPaths {
+		obj, err := m.evalManifest(manifestPath)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, instance := range obj.Modules {
+			if instance.Name == "" || (instance.SourceDir == "" && instance.Source == "") {
+				return nil, fmt.Errorf(
+					"sub-module in module %q must have `Name` and `Source` or `SourceDir` set (in %q)",
+					m.instance.Name, manifestPath)
+			}
+
+			if len(includedBy) >= MaxModuleDepth {
+				return nil, fmt.Errorf(
+					"cannot include module %q in module %q – only %d levels of nesting are allowed",
+					instance.Name, m.instance.Name, MaxModuleDepth)
+			}
+
+			dir, source, err := moduleSourceDir(instance, m.directory)
+			if err != nil {
+				return nil, err
+			}
+			for _, parentDir := range includedBy {
+				if sameFile(parentDir, dir) {
+					return nil, fmt.Errorf(
+						"cannot include module %q in module %q – %q includes itself [%s]",
+						instance.Name, m.instance.Name, dir, strings.Join(append(includedBy, dir), " → "))
+				}
+			}
+
+			// output of sub-modules goes under the output of the parent module
+			if instance.OutputDir == "" {
+				instance.OutputDir = instance.Name
+			}
+			instance.OutputDir = path.Join(m.instance.OutputDir, instance.OutputDir)
+			if instance.Namespace == "" {
+				instance.Namespace = m.instance.Namespace
+			}
+			instance.CommonLabels = util.MergeStringMaps(m.instance.CommonLabels, instance.CommonLabels)
+			instance.CommonAnnotations = util.MergeStringMaps(m.instance.CommonAnnotations, instance.CommonAnnotations)
+			instance.CommonLabelsInSelectors = instance.CommonLabelsInSelectors || m.instance.CommonLabelsInSelectors
+			instance.Images = mergeImageOverrides(m.instance.Images, instance.Images)
+			for _, o := range instance.Images {
+				if err := o.validate(); err != nil {
+					return nil, fmt.Errorf("error in module %q – %v", instance.Name, err)
+				}
+			}
+			// names of sub-module objects have to be unique in the same way as those of the parent
+			instance.NamePrefix = m.instance.NamePrefix + instance.NamePrefix
+			instance.NameSuffix = instance.NameSuffix + m.instance.NameSuffix
+			instance.Name = m.instance.Name + "/" + instance.Name
+			if source == nil {
+				instance.SourceDir = dir
+			}
+
+			subModule, err := NewModule(dir, instance.Name)
+			if err != nil {
+				return nil, err
+			}
+			subModule.instance = instance
+			subModule.source = source
+			subModule.inheritedSensitiveValues = m.sensitiveValues()
+
+			subModules = append(subModules, subModule)
+		}
+	}
+
+	return subModules, nil
+}
+
 func (m *Module) LoadGroups(instanceName, namespace string) (map[ManifestPath]resources.Group, error) {
 	groups := make(map[ManifestPath]resources.Group)
 
@@ -449,7 +1202,7 @@ func (m *Module) LoadGroups(instanceName, namespace string) (map[ManifestPath]re
 		// TODO also do something about multiple formats here
 		group := resources.Group{}
 		if err := loadObjWithModuleContext(&group, data, manifestPath, instanceName, m); err != nil {
-			return nil, err
+			return nil, m.redactError(err)
 		}
 
 		// Local namespace overrides global namespace if set
@@ -467,54 +1220,149 @@ func (m *Module) LoadGroups(instanceName, namespace string) (map[ManifestPath]re
 	return groups, nil
 }
 
-func (m *Module) EncodeGroupsToYAML(instance ModuleInstance) (map[ManifestPath][]byte, error) {
-	output := make(map[ManifestPath][]byte)
+// makeLists converts groups to lists of objects, which get modified as
+// the module instance requires, with all of the groups taken into account
+func (m *Module) makeLists(instance ModuleInstance) (map[ManifestPath]*metav1.List, error) {
 	groups, err := m.LoadGroups(instance.Name, instance.Namespace)
 	if err != nil {
 		return nil, err
 	}
 
+	lists := make(map[ManifestPath]*metav1.List, len(groups))
 	for manifestPath, group := range groups {
-		data, err := group.EncodeListToYAML()
+		group.CommonLabels = instance.CommonLabels
+		group.CommonAnnotations = instance.CommonAnnotations
+		group.CommonLabelsInSelectors = instance.CommonLabelsInSelectors
+
+		list, err := group.MakeList()
+		if err != nil {
+			return nil, m.redactError(err)
+		}
+		lists[manifestPath] = list
+	}
+
+	if instance.NamePrefix != "" || instance.NameSuffix != "" {
+		err := transformObjects(lists, func(objs []object) error {
+			m.renameWarnings = renameObjects(objs, instance.NamePrefix, instance.NameSuffix, instance.Name)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error renaming objects in module %q – %v", instance.Name, err)
+		}
+	}
+
+	if len(instance.Images) > 0 {
+		err := transformObjects(lists, func(objs []object) error {
+			m.matchedImages = overrideImages(objs, instance.Images)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error overriding images in module %q – %v", instance.Name, err)
+		}
+	}
+
+	if m.provenanceAnnotations {
+		sourceHash, err := m.SourceHash(instance)
 		if err != nil {
 			return nil, err
 		}
+		err = transformObjects(lists, func(objs []object) error {
+			addProvenanceAnnotations(objs, sourceHash)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error annotating objects in module %q – %v", instance.Name, err)
+		}
+	}
+
+	return lists, nil
+}
+
+func (m *Module) EncodeGroupsToYAML(instance ModuleInstance) (map[ManifestPath][]byte, error) {
+	output := make(map[ManifestPath][]byte)
+	lists, err := m.makeLists(instance)
+	if err != nil {
+		return nil, err
+	}
 
-		if data == nil {
+	sourceHash, err := m.SourceHash(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	for manifestPath, list := range lists {
+		if len(list.Items) == 0 {
 			continue
 		}
 
-		info := fmt.Sprintf(
-			"\n---\n#\n# Generated from module\n#\tName: %q\n#\tSourceDir: %q\n#\tmanifestPath: %q\n#\n\n",
-			// TODO add version of kubegen and subtree hash of the module
-			instance.Name,
-			instance.SourceDir,
-			manifestPath,
-		)
+		var data []byte
+		if m.yamlStyle == YAMLStyleStream {
+			if data, err = m.encodeYAMLStream(list); err != nil {
+				return nil, err
+			}
+		} else {
+			if data, err = util.EncodeList(list, "application/yaml", false); err != nil {
+				return nil, m.redactError(err)
+			}
+
+			if data, err = m.maskSensitiveValuesInOutput("application/yaml", data, false); err != nil {
+				return nil, err
+			}
+		}
 
-		output[manifestPath] = append([]byte(info), data...)
+		output[manifestPath] = append([]byte(m.yamlHeader(instance, manifestPath, sourceHash)), data...)
 	}
 
 	return output, nil
 }
 
+// yamlHeader starts a YAML document with a comment that shows where it was generated from
+func (m *Module) yamlHeader(instance ModuleInstance, manifestPath ManifestPath, sourceHash string) string {
+	sourceKey, source := "SourceDir", instance.SourceDir
+	if instance.Source != "" {
+		sourceKey, source = "Source", instance.Source
+	}
+
+	header := fmt.Sprintf(
+		"\n---\n#\n# Generated from module\n#\tName: %q\n#\t%s: %q\n#\tmanifestPath: %q\n",
+		instance.Name,
+		sourceKey, source,
+		manifestPath,
+	)
+	if !m.omitVersion {
+		header += fmt.Sprintf("#\tkubegenVersion: %q\n", version.Version)
+	}
+	return header + fmt.Sprintf("#\tsourceHash: %q\n#\n\n", sourceHash)
+}
+
 func (m *Module) EncodeGroupsToJSON(instance ModuleInstance) (map[ManifestPath][]byte, error) {
 	output := make(map[ManifestPath][]byte)
-	groups, err := m.LoadGroups(instance.Name, instance.Namespace)
+	lists, err := m.makeLists(instance)
 	if err != nil {
 		return nil, err
 	}
 
-	for manifestPath, group := range groups {
-		data, err := group.EncodeListToPrettyJSON()
-		if err != nil {
-			return nil, err
+	for manifestPath, list := range lists {
+		if len(list.Items) == 0 {
+			continue
 		}
 
-		if data == nil {
+		if m.jsonStyle == JSONStyleNDJSON {
+			if output[manifestPath], err = m.encodeNDJSON(list); err != nil {
+				return nil, err
+			}
 			continue
 		}
 
+		data, err := util.EncodeList(list, "application/json", true)
+		if err != nil {
+			return nil, m.redactError(err)
+		}
+
+		if data, err = m.maskSensitiveValuesInOutput("application/json", data, true); err != nil {
+			return nil, err
+		}
+
 		output[manifestPath] = append(data, byte('\n'))
 	}
 
@@ -0,0 +1,844 @@
+package modules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeFiles creates a temporary directory with the files, keyed by paths relative to it,
+// the directory is relative to the working directory, same as it usually is in a bundle
+func writeFiles(t *testing.T, files map[string]string) string {
+	tempDir, err := ioutil.TempDir("", "kubegen-modules-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.Rel(wd, tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// loadBundle loads the instances as a bundle, which is how all of the commands load modules
+func loadBundle(instances ...ModuleInstance) (*Bundle, error) {
+	bundle := &Bundle{Modules: instances, omitVersion: true}
+	if err := bundle.LoadModules(nil); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// generateObjects returns all of the objects generated by the bundle, in the same order as in the output
+func generateObjects(bundle *Bundle) ([]object, error) {
+	bundle.jsonStyle = JSONStyleNDJSON
+	for n := range bundle.loadedModules {
+		bundle.loadedModules[n].jsonStyle = JSONStyleNDJSON
+	}
+
+	data, err := bundle.EncodeAllToJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	objs := []object{}
+	for _, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		obj := make(object)
+		if err := json.Unmarshal(line, &obj); err != nil {
+			return nil, err
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+// generate loads a single module instance and returns all of the objects it generates
+func generate(instance ModuleInstance) ([]object, error) {
+	bundle, err := loadBundle(instance)
+	if err != nil {
+		return nil, err
+	}
+	return generateObjects(bundle)
+}
+
+// findObject returns the object of the given kind and name, or nil
+func findObject(objs []object, kind, name string) object {
+	for _, obj := range objs {
+		if obj["kind"] == kind && getString(obj, "metadata", "name") == name {
+			return obj
+		}
+	}
+	return nil
+}
+
+// getString returns a nested string by its keys, or an empty string
+func getString(obj object, keys ...string) string {
+	if len(keys) == 0 {
+		return ""
+	}
+	s, _ := getObject(obj, keys[:len(keys)-1]...)[keys[len(keys)-1]].(string)
+	return s
+}
+
+// firstContainer returns the first container of a pod controller
+func firstContainer(obj object) object {
+	containers, _ := getObject(obj, "spec", "template", "spec")["containers"].([]interface{})
+	if len(containers) == 0 {
+		return nil
+	}
+	container, _ := containers[0].(map[string]interface{})
+	return container
+}
+
+// portNames returns names of the ports of a container
+func portNames(container object) []string {
+	names := []string{}
+	ports, _ := container["ports"].([]interface{})
+	for _, p := range ports {
+		if p, ok := p.(map[string]interface{}); ok {
+			name, _ := p["name"].(string)
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func TestMergeKeys(t *testing.T) {
+	manifest := `
+Kind: kubegen.k8s.io/Module.v1alpha2
+%s
+Internals:
+- name: base
+  type: Object
+  value:
+    containers:
+    - name: app
+      image: app:1
+      ports:
+      - name: http
+        containerPort: 80
+      - name: metrics
+        containerPort: 9090
+Deployments:
+- name: app
+  kubegen.Object.Lookup: base
+  containers:
+  - name: app
+    ports:
+    - name: admin
+      containerPort: 9090
+`
+
+	tests := []struct {
+		mergeKeys string
+		ports     []string
+	}{
+		{"", []string{"http", "metrics", "admin"}},
+		{"MergeKeys: [containerPort]", []string{"http", "admin"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.mergeKeys, func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{"app.yml": fmt.Sprintf(manifest, test.mergeKeys)})
+			defer os.RemoveAll(dir)
+
+			objs, err := generate(ModuleInstance{Name: "test", SourceDir: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, test.ports, portNames(firstContainer(findObject(objs, "Deployment", "app"))))
+		})
+	}
+}
+
+func TestMergeKeysMustBeTheSame(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.yml": "Kind: kubegen.k8s.io/Module.v1alpha2\nMergeKeys: [name]\n",
+		"b.yml": "Kind: kubegen.k8s.io/Module.v1alpha2\nMergeKeys: [id]\n",
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := generate(ModuleInstance{Name: "test", SourceDir: dir})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "must be the same in all manifests")
+	}
+}
+
+func TestForEachParameter(t *testing.T) {
+	manifest := `
+Kind: kubegen.k8s.io/Module.v1alpha2
+Parameters:
+- name: zones
+  type: Array
+  default: [a, b]
+Services:
+- kubegen.Array.ForEach:
+    in: zones
+    as: zone
+    index: i
+    template:
+      name:
+        kubegen.String.Join: [frontend-, { kubegen.String.Lookup: zone }]
+      port: 80
+      annotations:
+        index:
+          kubegen.String.AsJSON: { kubegen.Number.Lookup: i }
+`
+
+	tests := []struct {
+		parameters map[string]interface{}
+		services   []string
+		err        string
+	}{
+		{nil, []string{"frontend-a", "frontend-b"}, ""},
+		{map[string]interface{}{"zones": []interface{}{"x", "y", "z"}}, []string{"frontend-x", "frontend-y", "frontend-z"}, ""},
+		{map[string]interface{}{"zones": []interface{}{}}, []string{}, ""},
+		{map[string]interface{}{"zones": "a"}, nil, `not of type "Array"`},
+		{map[string]interface{}{"zones": []interface{}{map[string]interface{}{"kubegen.String.Lookup": "x"}}}, nil, "must be a literal array"},
+	}
+
+	dir := writeFiles(t, map[string]string{"app.yml": manifest})
+	defer os.RemoveAll(dir)
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%v", test.parameters), func(t *testing.T) {
+			objs, err := generate(ModuleInstance{Name: "test", SourceDir: dir, Parameters: test.parameters})
+			if test.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			services := []string{}
+			for n, obj := range objs {
+				if obj["kind"] == "Service" {
+					services = append(services, getString(obj, "metadata", "name"))
+					assert.Equal(t, fmt.Sprintf("%d", n), getString(obj, "metadata", "annotations", "index"))
+				}
+			}
+			assert.Equal(t, test.services, services)
+		})
+	}
+}
+
+func TestMaskSensitiveValues(t *testing.T) {
+	manifest := `
+Kind: kubegen.k8s.io/Module.v1alpha2
+Parameters:
+- name: token
+  type: String
+  sensitive: true
+  required: true
+ConfigMaps:
+- name: app
+  data:
+    token: { kubegen.String.Lookup: token }
+    header: { kubegen.String.Join: ["Bearer ", { kubegen.String.Lookup: token }] }
+    scrape_interval: 5s
+    config.yml: { kubegen.String.AsYAML: { url: https://example.com, password: { kubegen.String.Lookup: token } } }
+`
+
+	// values are redacted wherever these appear in strings, but not when these are part of a longer word
+	tests := []struct {
+		token string
+		data  map[string]string
+	}{
+		{"hunter2", map[string]string{"token": "<redacted>", "header": "Bearer <redacted>", "scrape_interval": "5s",
+			"config.yml": "password: <redacted>\nurl: https://example.com\n"}},
+		{"e", map[string]string{"token": "<redacted>", "header": "Bearer <redacted>", "scrape_interval": "5s",
+			"config.yml": "password: <redacted>\nurl: https://example.com\n"}},
+		{"5s", map[string]string{"token": "<redacted>", "header": "Bearer <redacted>", "scrape_interval": "<redacted>",
+			"config.yml": "password: <redacted>\nurl: https://example.com\n"}},
+	}
+
+	dir := writeFiles(t, map[string]string{"app.yml": manifest})
+	defer os.RemoveAll(dir)
+
+	for _, test := range tests {
+		t.Run(test.token, func(t *testing.T) {
+			bundle, err := loadBundle(ModuleInstance{Name: "test", SourceDir: dir, Parameters: map[string]interface{}{"token": test.token}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			bundle.MaskSensitiveValues()
+			objs, err := generateObjects(bundle)
+			if err != nil {
+				t.Fatal(err)
+			}
+			configMap := findObject(objs, "ConfigMap", "app")
+			for k, v := range test.data {
+				assert.Equal(t, v, getString(configMap, "data", k), k)
+			}
+		})
+	}
+}
+
+func TestRedactSensitiveValuesInErrors(t *testing.T) {
+	manifest := `
+Kind: kubegen.k8s.io/Module.v1alpha2
+Parameters:
+- name: token
+  type: String
+  sensitive: true
+  required: true
+  pattern: "[a-z]+"
+- name: port
+  type: Number
+  sensitive: true
+  required: true
+`
+
+	tests := []struct {
+		parameters map[string]interface{}
+		err        string
+	}{
+		{
+			map[string]interface{}{"token": "e", "port": 80, "tokne": "x"},
+			`module "test" does not declare parameter "tokne" (did you mean "token"?)`,
+		},
+		{
+			map[string]interface{}{"token": "tokne", "port": 80, "tokne": "x"},
+			`module "test" does not declare parameter "<redacted>" (did you mean "token"?)`,
+		},
+		{
+			map[string]interface{}{"token": "Secret1", "port": 80},
+			`parameter "token" in module "test" does not satisfy constraint – must match pattern "[a-z]+" [value: "<redacted>"]`,
+		},
+		{
+			map[string]interface{}{"token": "e", "port": "http"},
+			`parameter "port" in module "test" not of type "Number" [value: "<redacted>"]`,
+		},
+	}
+
+	dir := writeFiles(t, map[string]string{"app.yml": manifest})
+	defer os.RemoveAll(dir)
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%v", test.parameters), func(t *testing.T) {
+			_, err := generate(ModuleInstance{Name: "test", SourceDir: dir, Parameters: test.parameters})
+			if assert.Error(t, err) {
+				assert.Equal(t, test.err, err.Error())
+			}
+		})
+	}
+}
+
+func TestParameterConstraints(t *testing.T) {
+	manifest := `
+Kind: kubegen.k8s.io/Module.v1alpha2
+Parameters:
+- name: x
+%s
+`
+
+	tests := []struct {
+		parameter string
+		value     interface{}
+		err       string
+	}{
+		{"  type: String\n  required: true\n  enum: [a, b]", "a", ""},
+		{"  type: String\n  required: true\n  enum: [a, b]", "c", `does not satisfy constraint – must be one of [a b] [value: "c"]`},
+		{"  type: String\n  required: true\n  enum: [\"1\", \"2\"]", "1", ""},
+		{"  type: String\n  required: true\n  enum: [1, 2]", "1", `must be one of [1 2] [value: "1"]`},
+		{"  type: Number\n  required: true\n  enum: [1, 2]", 2.0, ""},
+		{"  type: Number\n  required: true\n  enum: [\"1\", \"2\"]", 1.0, `must be one of [1 2] [value: 1]`},
+		{"  type: String\n  required: true\n  pattern: \"[a-z]+\"", "abc", ""},
+		{"  type: String\n  required: true\n  pattern: \"[a-z]+\"", "abc1", `must match pattern "[a-z]+"`},
+		{"  type: String\n  required: true\n  pattern: \"[a-z\"", "abc", "`pattern` is not a valid regular expression"},
+		{"  type: String\n  required: true\n  min: 1", "abc", "`min` and `max` only apply to parameters of type \"Number\""},
+		{"  type: String\n  required: true\n  minLength: 2\n  maxLength: 3", "abc", ""},
+		{"  type: String\n  required: true\n  minLength: 2\n  maxLength: 3", "a", "length must be no less than 2"},
+		{"  type: String\n  required: true\n  minLength: 2\n  maxLength: 3", "abcd", "length must be no greater than 3"},
+		{"  type: Number\n  required: true\n  min: 1\n  max: 3", 3.0, ""},
+		{"  type: Number\n  required: true\n  min: 1\n  max: 3", 0.0, "must be no less than 1 [value: 0]"},
+		{"  type: Number\n  required: true\n  min: 1\n  max: 3", 4.0, "must be no greater than 3 [value: 4]"},
+		{"  type: Number\n  required: true\n  min: 1\n  max: 3", 3.7, "must be no greater than 3 [value: 3.7]"},
+		{"  type: Number\n  required: true\n  min: 1\n  max: 3", 0.5, "must be no less than 1 [value: 0.5]"},
+		{"  type: Number\n  required: true", 0.5, "must be a whole number between -2147483648 and 2147483647 [value: 0.5]"},
+		{"  type: Number\n  required: true", 3000000000.0, "must be a whole number between -2147483648 and 2147483647 [value: 3e+09]"},
+		{"  type: Number\n  required: true\n  sensitive: true", 3000000000.0, "must be a whole number between -2147483648 and 2147483647 [value: \"<redacted>\"]"},
+		{"  type: Number\n  default: 1.5", nil, "must be a whole number"},
+		{"  type: Number\n  required: true\n  pattern: \"1\"", 1.0, "`pattern`, `minLength` and `maxLength` don't apply to parameters of type \"Number\""},
+		{"  type: Number\n  default: 0\n  min: 1", nil, "must be no less than 1 [value: 0]"},
+		{"  type: Number\n  default: 2\n  min: 1", nil, ""},
+		{"  type: Array\n  required: true\n  minLength: 1\n  maxLength: 2", []interface{}{"a"}, ""},
+		{"  type: Array\n  required: true\n  minLength: 1\n  maxLength: 2", []interface{}{}, "length must be no less than 1"},
+		{"  type: Array\n  required: true\n  minLength: 1\n  maxLength: 2", []interface{}{"a", "b", "c"}, "length must be no greater than 2"},
+		{"  type: Array\n  required: true\n  enum: [[a], [b]]", []interface{}{"b"}, ""},
+		{"  type: Array\n  required: true\n  max: 1", []interface{}{"a"}, "`min`, `max` and `pattern` don't apply to arrays"},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s=%v", test.parameter, test.value), func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{"app.yml": fmt.Sprintf(manifest, test.parameter)})
+			defer os.RemoveAll(dir)
+
+			parameters := map[string]interface{}{}
+			if test.value != nil {
+				parameters["x"] = test.value
+			}
+			_, err := generate(ModuleInstance{Name: "test", SourceDir: dir, Parameters: parameters})
+			if test.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), test.err)
+			}
+		})
+	}
+}
+
+func TestParameterTypes(t *testing.T) {
+	manifest := `
+Kind: kubegen.k8s.io/Module.v1alpha2
+Parameters:
+- name: x
+  type: %s
+  required: true
+`
+
+	tests := []struct {
+		kind  string
+		value interface{}
+		err   string
+	}{
+		{"String", "1", ""},
+		{"String", 1.0, `parameter "x" in module "test" not of type "String" [value: 1] – a value that looks like a number or a boolean has to be quoted to be a string`},
+		{"String", true, `not of type "String" [value: true] – a value that looks like a number`},
+		{"String", []interface{}{"a"}, `not of type "String" [value: []interface {}{"a"}]`},
+		{"Number", 1.0, ""},
+		{"Number", "1", `parameter "x" in module "test" not of type "Number" [value: "1"]`},
+		{"Array", []interface{}{"a", 1.0}, ""},
+		{"Array", "a", `not of type "Array" [value: "a"]`},
+		{"Boolean", true, `of unknown type "Boolean", only types "String", "Number" and "Array" are supported`},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s=%v", test.kind, test.value), func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{"app.yml": fmt.Sprintf(manifest, test.kind)})
+			defer os.RemoveAll(dir)
+
+			_, err := generate(ModuleInstance{Name: "test", SourceDir: dir, Parameters: map[string]interface{}{"x": test.value}})
+			if test.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), test.err)
+			}
+		})
+	}
+}
+
+// appModule is a module used by tests of bundles, it has a parameter of each kind
+const appModule = `
+Kind: kubegen.k8s.io/Module.v1alpha2
+Parameters:
+- name: image
+  type: String
+  default: app:1
+- name: domain
+  type: String
+  required: true
+- name: token
+  type: String
+  sensitive: true
+  default: hunter2
+Deployments:
+- name: app
+  containers:
+  - name: app
+    image: { kubegen.String.Lookup: image }
+    args:
+    - kubegen.String.Join: [--domain=, { kubegen.String.Lookup: domain }]
+`
+
+func TestBundleParameters(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"modules/app/app.yml": appModule,
+		"bundle.yml": `
+Kind: kubegen.k8s.io/Bundle.v1alpha2
+Parameters:
+  domain: example.com
+  image: app:2
+Modules:
+- Name: prod
+  SourceDir: modules/app
+- Name: test
+  SourceDir: modules/app
+  Parameters:
+    domain: test.example.com
+    token: abc
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	bundle, err := NewBundle(filepath.Join(dir, "bundle.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle.omitVersion = true
+	if err := bundle.LoadModules(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	objs, err := generateObjects(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := []string{}
+	for _, obj := range objs {
+		container := firstContainer(obj)
+		args = append(args, fmt.Sprintf("%s %v", container["image"], container["args"]))
+	}
+	assert.Equal(t, []string{"app:2 [--domain=example.com]", "app:2 [--domain=test.example.com]"}, args)
+
+	explanation, err := bundle.Explain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, `MODULE  PARAMETER  VALUE             SOURCE
+prod    domain     example.com       bundle
+prod    image      app:2             bundle
+prod    token      <redacted>        default
+test    domain     test.example.com  instance
+test    image      app:2             bundle
+test    token      <redacted>        instance
+`, string(explanation))
+}
+
+func TestNestedModules(t *testing.T) {
+	parent := `
+Kind: kubegen.k8s.io/Module.v1alpha2
+Parameters:
+- name: domain
+  type: String
+  required: true
+Modules:
+- Name: %s
+  SourceDir: %s
+  Parameters:
+    domain:
+      kubegen.String.Join: [www., { kubegen.String.Lookup: %s }]
+Services:
+- name: web
+  port: 80
+`
+	tests := []struct {
+		name, sourceDir, lookup string
+		objs                    []string
+		err                     string
+	}{
+		{
+			"app", "../app", "domain",
+			[]string{"Service test-web", "Deployment test-app [--domain=www.example.com]"},
+			"",
+		},
+		{
+			"app", "../app", "domian",
+			nil,
+			`undeclared attribute "domian"`,
+		},
+		{
+			"self", ".", "domain",
+			nil,
+			`cannot include module "self" in module "parent" – `,
+		},
+		{
+			"self", "../parent", "domain",
+			nil,
+			`cannot include module "self" in module "parent" – `,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.sourceDir+" "+test.lookup, func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{
+				"parent/parent.yml": fmt.Sprintf(parent, test.name, test.sourceDir, test.lookup),
+				"app/app.yml":       appModule,
+			})
+			defer os.RemoveAll(dir)
+
+			bundle, err := loadBundle(ModuleInstance{
+				Name:       "parent",
+				SourceDir:  filepath.Join(dir, "parent"),
+				OutputDir:  "out",
+				Namespace:  "shop",
+				NamePrefix: "test-",
+				Parameters: map[string]interface{}{
+					"domain": "example.com",
+				},
+			})
+			if test.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			instances := []string{}
+			for _, m := range bundle.loadedModules {
+				instances = append(instances, m.instance.Name+" "+m.instance.OutputDir)
+			}
+			assert.Equal(t, []string{"parent out", "parent/app out/app"}, instances)
+
+			objs, err := generateObjects(bundle)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := []string{}
+			for _, obj := range objs {
+				assert.Equal(t, "shop", getString(obj, "metadata", "namespace"))
+				name := fmt.Sprintf("%s %s", obj["kind"], getString(obj, "metadata", "name"))
+				if container := firstContainer(obj); container != nil {
+					name += fmt.Sprintf(" %v", container["args"])
+				}
+				names = append(names, name)
+			}
+			assert.Equal(t, test.objs, names)
+		})
+	}
+}
+
+func TestMaxModuleDepth(t *testing.T) {
+	files := map[string]string{}
+	for n := 0; n <= MaxModuleDepth; n++ {
+		files[fmt.Sprintf("m%d/m.yml", n)] = fmt.Sprintf(
+			"Kind: kubegen.k8s.io/Module.v1alpha2\nModules:\n- Name: m%d\n  SourceDir: ../m%d\n", n+1, n+1)
+	}
+	files[fmt.Sprintf("m%d/m.yml", MaxModuleDepth+1)] = "Kind: kubegen.k8s.io/Module.v1alpha2\n"
+	dir := writeFiles(t, files)
+	defer os.RemoveAll(dir)
+
+	_, err := loadBundle(ModuleInstance{Name: "m0", SourceDir: filepath.Join(dir, "m0")})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), fmt.Sprintf("only %d levels of nesting are allowed", MaxModuleDepth))
+	}
+}
+
+func TestInternals(t *testing.T) {
+	module := `
+Kind: kubegen.k8s.io/Module.v1alpha2
+Parameters:
+- name: registry
+  type: String
+  default: docker.io
+Internals:
+%s
+Deployments:
+- name: app
+  containers:
+  - name: app
+    image: { kubegen.String.Lookup: image }
+`
+	tests := []struct {
+		internals string
+		image     string
+		err       string
+	}{
+		{
+			`
+- name: image
+  type: String
+  value: { kubegen.String.Join: [{ kubegen.String.Lookup: registry }, /app:1] }
+`,
+			"quay.io/app:1",
+			"",
+		},
+		{
+			`
+- name: image
+  type: String
+  value: { kubegen.String.Join: [{ kubegen.String.Lookup: repository }, ":", { kubegen.String.Lookup: tag }] }
+- name: repository
+  type: String
+  value: { kubegen.String.Join: [{ kubegen.String.Lookup: registry }, /app] }
+- name: tag
+  type: String
+  value: "2"
+`,
+			"quay.io/app:2",
+			"",
+		},
+		{
+			`
+- name: image
+  type: String
+  value: { kubegen.String.Lookup: repository }
+- name: repository
+  type: String
+  value: { kubegen.String.Lookup: image }
+`,
+			"",
+			`cyclic references between internals in module "app" [image → repository → image]`,
+		},
+		{
+			`
+- name: image
+  type: String
+  value: { kubegen.String.Join: [{ kubegen.String.Lookup: image }, ":1"] }
+`,
+			"",
+			`internal "image" in module "app" refers to itself`,
+		},
+		{
+			`
+- name: image
+  type: String
+  value: app
+- name: registry
+  type: String
+  value: quay.io
+`,
+			"",
+			`cannot declare internal "registry" in module "app"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.err, func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{
+				"app/app.yml": fmt.Sprintf(module, test.internals),
+			})
+			defer os.RemoveAll(dir)
+
+			objs, err := generate(ModuleInstance{
+				Name:       "app",
+				SourceDir:  filepath.Join(dir, "app"),
+				Parameters: map[string]interface{}{"registry": "quay.io"},
+			})
+			if test.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if assert.Len(t, objs, 1) {
+				assert.Equal(t, test.image, firstContainer(objs[0])["image"])
+			}
+		})
+	}
+}
+
+func TestCommonLabels(t *testing.T) {
+	for _, inSelectors := range []bool{false, true} {
+		t.Run(fmt.Sprintf("CommonLabelsInSelectors: %v", inSelectors), func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{
+				"modules/app/app.yml": `
+Kind: kubegen.k8s.io/Module.v1alpha2
+Services:
+- name: web
+  port: 80
+Deployments:
+- name: web
+  annotations: { owner: web-team }
+  containers: [{ name: web, image: web }]
+Resources:
+- path: worker.yml
+`,
+				"modules/app/worker.yml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata: { name: worker, labels: { app: worker, team: workers } }
+spec:
+  selector: { matchLabels: { app: worker } }
+  template:
+    metadata: { labels: { app: worker } }
+    spec:
+      containers: [{ name: worker, image: worker }]
+`,
+				"bundle.yml": fmt.Sprintf(`
+Kind: kubegen.k8s.io/Bundle.v1alpha2
+CommonLabels: { team: shop, environment: prod }
+CommonAnnotations: { owner: shop-team }
+CommonLabelsInSelectors: %v
+Modules:
+- Name: app
+  SourceDir: modules/app
+  CommonLabels: { environment: staging }
+`, inSelectors),
+			})
+			defer os.RemoveAll(dir)
+
+			bundle, err := NewBundle(filepath.Join(dir, "bundle.yml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			bundle.omitVersion = true
+			if err := bundle.LoadModules(nil); err != nil {
+				t.Fatal(err)
+			}
+			objs, err := generateObjects(bundle)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			common := map[string]interface{}{"environment": "staging", "team": "shop"}
+			withCommon := func(labels map[string]interface{}) map[string]interface{} {
+				result := map[string]interface{}{}
+				for k, v := range common {
+					result[k] = v
+				}
+				for k, v := range labels {
+					result[k] = v
+				}
+				return result
+			}
+			selector := func(labels map[string]interface{}) map[string]interface{} {
+				if inSelectors {
+					return withCommon(labels)
+				}
+				return labels
+			}
+
+			service := findObject(objs, "Service", "web")
+			assert.Equal(t, withCommon(object{"name": "web"}), getObject(service, "metadata", "labels"))
+			assert.Equal(t, object{"owner": "shop-team"}, getObject(service, "metadata", "annotations"))
+			assert.Equal(t, selector(object{"name": "web"}), getObject(service, "spec", "selector"))
+
+			web := findObject(objs, "Deployment", "web")
+			assert.Equal(t, withCommon(object{"name": "web"}), getObject(web, "metadata", "labels"))
+			assert.Equal(t, object{"owner": "web-team"}, getObject(web, "metadata", "annotations"))
+			assert.Equal(t, withCommon(object{"name": "web"}), getObject(getPodTemplateMetadata(web), "labels"))
+			assert.Equal(t, selector(object{"name": "web"}), getObject(web, "spec", "selector", "matchLabels"))
+
+			worker := findObject(objs, "Deployment", "worker")
+			assert.Equal(t, object{"app": "worker", "environment": "staging", "team": "workers"}, getObject(worker, "metadata", "labels"))
+			assert.Equal(t, object{"owner": "shop-team"}, getObject(worker, "metadata", "annotations"))
+			assert.Equal(t, withCommon(object{"app": "worker"}), getObject(getPodTemplateMetadata(worker), "labels"))
+			assert.Equal(t, selector(object{"app": "worker"}), getObject(worker, "spec", "selector", "matchLabels"))
+		})
+	}
+}
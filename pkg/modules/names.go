@@ -0,0 +1,207 @@
+package modules
+
+import (
+	"fmt"
+)
+
+// nameLabel is the label kubegen sets on objects that have no labels declared,
+// and as it's used by selectors by default, it has to be renamed with the object
+const nameLabel = "name"
+
+// objectRenamer adds prefix and suffix to names of all objects generated by a module instance,
+// references are only renamed when they point to an object in the same instance, so that
+// anything that exists outside of the module can still be referred to
+type objectRenamer struct {
+	prefix, suffix string
+	instanceName   string
+	// names has original names of objects by kind
+	names map[string]map[string]bool
+	// allNames has original names of objects of any kind, which is what `name` label is matched against
+	allNames map[string]bool
+
+	// kind and name of the object that is being renamed, for the warnings
+	kind, name string
+	warnings   []string
+}
+
+// renameObjects returns warnings about references to objects that are not generated by the module
+// instance, and selectors that could not be renamed, as these may select pods of other instances
+func renameObjects(objs []object, prefix, suffix, instanceName string) []string {
+	r := &objectRenamer{
+		prefix:       prefix,
+		suffix:       suffix,
+		instanceName: instanceName,
+		names:        make(map[string]map[string]bool),
+		allNames:     make(map[string]bool),
+		warnings:     []string{},
+	}
+
+	for _, obj := range objs {
+		kind, name := getKind(obj), getName(obj)
+		if name == "" {
+			continue
+		}
+		if r.names[kind] == nil {
+			r.names[kind] = make(map[string]bool)
+		}
+		r.names[kind][name] = true
+		r.allNames[name] = true
+	}
+
+	for _, obj := range objs {
+		r.rename(obj)
+	}
+	return r.warnings
+}
+
+func (r *objectRenamer) renameField(obj object, key, kind string) {
+	if obj == nil {
+		return
+	}
+	name, ok := obj[key].(string)
+	if !ok || name == "" {
+		return
+	}
+	if !r.names[kind][name] {
+		r.warnings = append(r.warnings, fmt.Sprintf(
+			"%s %q in module %q refers to %s %q, which is not generated by the module, so the reference is not renamed",
+			r.kind, r.name, r.instanceName, kind, name))
+		return
+	}
+	obj[key] = r.prefix + name + r.suffix
+}
+
+// renameLabels renames the `name` label, and returns false if there was
+// no label to rename in a selector that is set
+func (r *objectRenamer) renameLabels(labels object) bool {
+	if len(labels) == 0 {
+		return true
+	}
+	if name, ok := labels[nameLabel].(string); ok && r.allNames[name] {
+		labels[nameLabel] = r.prefix + name + r.suffix
+		return true
+	}
+	return false
+}
+
+// renameSelector renames the `name` label in a selector, and warns if there is no label to rename
+func (r *objectRenamer) renameSelector(description string, labels object) {
+	if !r.renameLabels(labels) {
+		r.warnings = append(r.warnings, fmt.Sprintf(
+			"%s of %s %q in module %q has no %q label that refers to an object in the module, so it may select pods of other instances",
+			description, r.kind, r.name, r.instanceName, nameLabel))
+	}
+}
+
+// renameRef renames a reference to an object of any kind, which is set along with the name
+func (r *objectRenamer) renameRef(ref object) {
+	if kind, ok := ref["kind"].(string); ok {
+		r.renameField(ref, "name", kind)
+	}
+}
+
+func (r *objectRenamer) rename(obj object) {
+	kind := getKind(obj)
+
+	r.renameField(getObject(obj, "metadata"), "name", kind)
+	r.renameLabels(getObject(obj, "metadata", "labels"))
+	r.kind, r.name = kind, getName(obj)
+
+	switch kind {
+	case "Service":
+		r.renameSelector("selector", getObject(obj, "spec", "selector"))
+	case "Ingress":
+		for _, backend := range getIngressBackends(obj) {
+			r.renameField(backend, "serviceName", "Service")
+			r.renameField(getObject(backend, "service"), "name", "Service")
+		}
+		for _, tls := range getObjects(obj, "spec", "tls") {
+			r.renameField(tls, "secretName", "Secret")
+		}
+	case "HorizontalPodAutoscaler":
+		r.renameRef(getObject(obj, "spec", "scaleTargetRef"))
+	case "RoleBinding", "ClusterRoleBinding":
+		r.renameRef(getObject(obj, "roleRef"))
+		for _, subject := range getObjects(obj, "subjects") {
+			r.renameRef(subject)
+		}
+	case "NetworkPolicy":
+		r.renameSelector("pod selector", getObject(obj, "spec", "podSelector", "matchLabels"))
+		for _, peer := range append(getNetworkPolicyPeers(obj, "ingress", "from"), getNetworkPolicyPeers(obj, "egress", "to")...) {
+			r.renameLabels(getObject(peer, "podSelector", "matchLabels"))
+		}
+	case "StatefulSet":
+		r.renameField(getObject(obj, "spec"), "serviceName", "Service")
+		fallthrough
+	case "PodDisruptionBudget":
+		r.renameSelector("selector", getObject(obj, "spec", "selector", "matchLabels"))
+	default:
+		// selectors of other kinds, e.g. of PersistentVolumeClaims, don't select pods
+		if getPodSpec(obj) != nil {
+			r.renameSelector("selector", getObject(obj, "spec", "selector", "matchLabels"))
+		} else {
+			r.renameLabels(getObject(obj, "spec", "selector", "matchLabels"))
+		}
+	}
+
+	r.renameLabels(getObject(getPodTemplateMetadata(obj), "labels"))
+
+	podSpec := getPodSpec(obj)
+	if podSpec == nil {
+		return
+	}
+
+	r.renameField(podSpec, "serviceAccountName", "ServiceAccount")
+
+	for _, secret := range getObjects(podSpec, "imagePullSecrets") {
+		r.renameField(secret, "name", "Secret")
+	}
+
+	for _, volume := range getObjects(podSpec, "volumes") {
+		r.renameField(getObject(volume, "secret"), "secretName", "Secret")
+		r.renameField(getObject(volume, "configMap"), "name", "ConfigMap")
+		r.renameField(getObject(volume, "persistentVolumeClaim"), "claimName", "PersistentVolumeClaim")
+		for _, source := range getObjects(volume, "projected", "sources") {
+			r.renameField(getObject(source, "secret"), "name", "Secret")
+			r.renameField(getObject(source, "configMap"), "name", "ConfigMap")
+		}
+	}
+
+	for _, container := range getContainers(podSpec) {
+		for _, env := range getObjects(container, "env") {
+			r.renameField(getObject(env, "valueFrom", "secretKeyRef"), "name", "Secret")
+			r.renameField(getObject(env, "valueFrom", "configMapKeyRef"), "name", "ConfigMap")
+		}
+		for _, envFrom := range getObjects(container, "envFrom") {
+			r.renameField(getObject(envFrom, "secretRef"), "name", "Secret")
+			r.renameField(getObject(envFrom, "configMapRef"), "name", "ConfigMap")
+		}
+	}
+}
+
+// getIngressBackends returns the default backend and backends of all paths of an ingress
+func getIngressBackends(obj object) []object {
+	backends := []object{}
+	for _, key := range []string{"backend", "defaultBackend"} {
+		if backend := getObject(obj, "spec", key); backend != nil {
+			backends = append(backends, backend)
+		}
+	}
+	for _, rule := range getObjects(obj, "spec", "rules") {
+		for _, p := range getObjects(rule, "http", "paths") {
+			if backend := getObject(p, "backend"); backend != nil {
+				backends = append(backends, backend)
+			}
+		}
+	}
+	return backends
+}
+
+// getNetworkPolicyPeers returns peers of all of the ingress or egress rules
+func getNetworkPolicyPeers(obj object, rulesKey, peersKey string) []object {
+	peers := []object{}
+	for _, rule := range getObjects(obj, "spec", rulesKey) {
+		peers = append(peers, getObjects(rule, peersKey)...)
+	}
+	return peers
+}
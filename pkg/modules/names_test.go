@@ -0,0 +1,161 @@
+package modules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamePrefixAndSuffix(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"app/app.yml": `
+Kind: kubegen.k8s.io/Module.v1alpha2
+Services:
+- name: web
+  port: 80
+Resources:
+- path: raw/pvc.yml
+- path: raw/role.yml
+- path: raw/rolebinding.yml
+- path: raw/serviceaccount.yml
+- path: raw/networkpolicy.yml
+- path: raw/hpa.yml
+- path: raw/worker.yml
+`,
+		"app/db.yml": `
+Kind: kubegen.k8s.io/Module.v1alpha2
+Services:
+- name: db
+  port: 5432
+`,
+		"app/raw/pvc.yml": `
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata: { name: data }
+spec:
+  accessModes: [ReadWriteOnce]
+  resources: { requests: { storage: 1Gi } }
+`,
+		"app/raw/role.yml": `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata: { name: reader }
+rules: [{ apiGroups: [""], resources: [pods], verbs: [get] }]
+`,
+		"app/raw/rolebinding.yml": `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata: { name: reader }
+roleRef: { apiGroup: rbac.authorization.k8s.io, kind: Role, name: reader }
+subjects:
+- { kind: ServiceAccount, name: worker }
+- { kind: ServiceAccount, name: monitoring }
+`,
+		"app/raw/serviceaccount.yml": `
+apiVersion: v1
+kind: ServiceAccount
+metadata: { name: worker }
+`,
+		"app/raw/networkpolicy.yml": `
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata: { name: web }
+spec:
+  podSelector: { matchLabels: { name: web } }
+  ingress:
+  - from: [{ podSelector: { matchLabels: { name: worker } } }]
+`,
+		"app/raw/hpa.yml": `
+apiVersion: autoscaling/v1
+kind: HorizontalPodAutoscaler
+metadata: { name: worker }
+spec:
+  scaleTargetRef: { apiVersion: apps/v1, kind: Deployment, name: worker }
+  maxReplicas: 3
+`,
+		"app/raw/worker.yml": `
+apiVersion: apps/v1
+kind: Deployment
+metadata: { name: worker, labels: { app: worker } }
+spec:
+  selector: { matchLabels: { app: worker } }
+  template:
+    metadata: { labels: { app: worker } }
+    spec:
+      serviceAccountName: worker
+      imagePullSecrets: [{ name: registry }]
+      containers: [{ name: worker, image: worker }]
+      volumes:
+      - { name: data, persistentVolumeClaim: { claimName: data } }
+      - { name: shared, persistentVolumeClaim: { claimName: shared } }
+      - name: config
+        projected:
+          sources: [{ serviceAccountToken: { path: token } }]
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	bundle, err := loadBundle(ModuleInstance{
+		Name:       "app",
+		SourceDir:  filepath.Join(dir, "app"),
+		NamePrefix: "test-",
+		NameSuffix: "-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, err := generateObjects(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, obj := range objs {
+		names = append(names, fmt.Sprintf("%s %s", obj["kind"], getString(obj, "metadata", "name")))
+	}
+	assert.Equal(t, []string{
+		"Service test-web-1",
+		"PersistentVolumeClaim test-data-1",
+		"Role test-reader-1",
+		"RoleBinding test-reader-1",
+		"ServiceAccount test-worker-1",
+		"NetworkPolicy test-web-1",
+		"HorizontalPodAutoscaler test-worker-1",
+		"Deployment test-worker-1",
+		"Service test-db-1",
+	}, names)
+
+	assert.Equal(t, "test-web-1", getString(findObject(objs, "Service", "test-web-1"), "spec", "selector", "name"))
+
+	roleBinding := findObject(objs, "RoleBinding", "test-reader-1")
+	assert.Equal(t, "test-reader-1", getString(roleBinding, "roleRef", "name"))
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"kind": "ServiceAccount", "name": "test-worker-1"},
+		map[string]interface{}{"kind": "ServiceAccount", "name": "monitoring"},
+	}, roleBinding["subjects"])
+
+	networkPolicy := findObject(objs, "NetworkPolicy", "test-web-1")
+	assert.Equal(t, "test-web-1", getString(networkPolicy, "spec", "podSelector", "matchLabels", "name"))
+	assert.Equal(t, "test-worker-1", getString(getObjects(getObjects(networkPolicy, "spec", "ingress")[0], "from")[0], "podSelector", "matchLabels", "name"))
+
+	assert.Equal(t, "test-worker-1", getString(findObject(objs, "HorizontalPodAutoscaler", "test-worker-1"), "spec", "scaleTargetRef", "name"))
+
+	podSpec := getPodSpec(findObject(objs, "Deployment", "test-worker-1"))
+	assert.Equal(t, "test-worker-1", podSpec["serviceAccountName"])
+	assert.Equal(t, "registry", getString(getObjects(podSpec, "imagePullSecrets")[0], "name"))
+	claims := []string{}
+	for _, volume := range getObjects(podSpec, "volumes") {
+		claims = append(claims, getString(volume, "persistentVolumeClaim", "claimName"))
+	}
+	assert.Equal(t, []string{"test-data-1", "shared", ""}, claims)
+
+	assert.Equal(t, []string{
+		`RoleBinding "test-reader-1" in module "app" refers to ServiceAccount "monitoring", which is not generated by the module, so the reference is not renamed`,
+		`selector of Deployment "test-worker-1" in module "app" has no "name" label that refers to an object in the module, so it may select pods of other instances`,
+		`Deployment "test-worker-1" in module "app" refers to Secret "registry", which is not generated by the module, so the reference is not renamed`,
+		`Deployment "test-worker-1" in module "app" refers to PersistentVolumeClaim "shared", which is not generated by the module, so the reference is not renamed`,
+	}, bundle.Warnings())
+}
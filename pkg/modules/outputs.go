@@ -0,0 +1,237 @@
+package modules
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FromModuleKey can be used in parameters of a module instance in a bundle,
+// to obtain value of an output of another instance, e.g. "db.service_host"
+const FromModuleKey = "kubegen.FromModule"
+
+// loadOutputs evaluates outputs of the module against its attributes
+func (m *Module) loadOutputs() error {
+	m.outputs = make(map[string]interface{}, len(m.Outputs))
+
+	manifestPaths := []ManifestPath{}
+	for _, output := range m.Outputs {
+		if len(manifestPaths) == 0 || manifestPaths[len(manifestPaths)-1] != output.declaredIn {
+			manifestPaths = append(manifestPaths, output.declaredIn)
+		}
+	}
+
+	for _, manifestPath := range manifestPaths {
+		obj, err := m.evalManifest(manifestPath)
+		if err != nil {
+			return err
+		}
+
+		for _, output := range obj.Outputs {
+			if _, ok := m.outputs[output.Name]; ok {
+				return fmt.Errorf("output %q in module %q is already defined", output.Name, m.instance.Name)
+			}
+			m.outputs[output.Name] = output.Value
+		}
+	}
+
+	return nil
+}
+
+func getModuleOutputReference(v interface{}) (string, bool) {
+	obj, ok := v.(map[string]interface{})
+	if !ok || len(obj) != 1 {
+		return "", false
+	}
+	ref, ok := obj[FromModuleKey].(string)
+	return ref, ok
+}
+
+func parseModuleOutputReference(ref string) (string, string, error) {
+	n := strings.LastIndex(ref, ".")
+	if n < 1 || n == len(ref)-1 {
+		return "", "", fmt.Errorf("invalid reference %q in `%s`, expected \"<module>.<output>\"", ref, FromModuleKey)
+	}
+	return ref[:n], ref[n+1:], nil
+}
+
+// findModuleOutputReferences returns names of the module instances that this one refers to
+func findModuleOutputReferences(v interface{}) ([]string, error) {
+	if ref, ok := getModuleOutputReference(v); ok {
+		instanceName, _, err := parseModuleOutputReference(ref)
+		if err != nil {
+			return nil, err
+		}
+		return []string{instanceName}, nil
+	}
+
+	names := []string{}
+	switch v.(type) {
+	case map[string]interface{}:
+		keys := []string{}
+		for k := range v.(map[string]interface{}) {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			found, err := findModuleOutputReferences(v.(map[string]interface{})[k])
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, found...)
+		}
+	case []interface{}:
+		for _, x := range v.([]interface{}) {
+			found, err := findModuleOutputReferences(x)
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, found...)
+		}
+	}
+	return names, nil
+}
+
+// refersToModuleOutputs checks if any of the references in the value are to outputs of the given instance,
+// invalid references are ignored here, as these are reported when instances are sorted
+func refersToModuleOutputs(v interface{}, instanceName string) bool {
+	names, _ := findModuleOutputReferences(v)
+	for _, name := range names {
+		if name == instanceName {
+			return true
+		}
+	}
+	return false
+}
+
+// sortModuleInstances orders instances, so that each of them comes after any instances whose
+// outputs it refers to, otherwise the order remains as it was
+func sortModuleInstances(instances []ModuleInstance) ([]ModuleInstance, error) {
+	index := make(map[string]int, len(instances))
+	defined := make(map[string]int, len(instances))
+	for n, i := range instances {
+		index[i.Name] = n
+		defined[i.Name]++
+	}
+
+	dependencies := make([][]int, len(instances))
+	for n, i := range instances {
+		names, err := findModuleOutputReferences(i.Parameters)
+		if err != nil {
+			return nil, fmt.Errorf("error in parameters of module %q – %v", i.Name, err)
+		}
+		for _, name := range names {
+			if _, ok := index[name]; !ok {
+				return nil, fmt.Errorf(
+					"module %q refers to outputs of module %q, which is not defined (or not selected)",
+					i.Name, name)
+			}
+			if defined[name] > 1 {
+				return nil, fmt.Errorf(
+					"module %q refers to outputs of module %q, which is defined more than once",
+					i.Name, name)
+			}
+			dependencies[n] = append(dependencies[n], index[name])
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(instances))
+	sorted := make([]ModuleInstance, 0, len(instances))
+	chain := []string{}
+
+	var visit func(n int) error
+	visit = func(n int) error {
+		switch state[n] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("cyclic dependency between outputs of modules [%s]",
+				strings.Join(append(chain, instances[n].Name), " → "))
+		}
+		state[n] = visiting
+		chain = append(chain, instances[n].Name)
+		for _, d := range dependencies[n] {
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		chain = chain[:len(chain)-1]
+		state[n] = visited
+		sorted = append(sorted, instances[n])
+		return nil
+	}
+
+	for n := range instances {
+		if err := visit(n); err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
+
+// resolveModuleOutputs replaces references to outputs of other modules with values
+func (i *ModuleInstance) resolveModuleOutputs(outputs map[string]map[string]interface{}) error {
+	var resolve func(v interface{}) (interface{}, error)
+	resolve = func(v interface{}) (interface{}, error) {
+		if ref, ok := getModuleOutputReference(v); ok {
+			instanceName, outputName, err := parseModuleOutputReference(ref)
+			if err != nil {
+				return nil, err
+			}
+			value, ok := outputs[instanceName][outputName]
+			if !ok {
+				return nil, fmt.Errorf("module %q has no output %q", instanceName, outputName)
+			}
+			return value, nil
+		}
+
+		switch v.(type) {
+		case map[string]interface{}:
+			obj := make(map[string]interface{}, len(v.(map[string]interface{})))
+			for k, x := range v.(map[string]interface{}) {
+				value, err := resolve(x)
+				if err != nil {
+					return nil, err
+				}
+				obj[k] = value
+			}
+			return obj, nil
+		case []interface{}:
+			arr := make([]interface{}, len(v.([]interface{})))
+			for n, x := range v.([]interface{}) {
+				value, err := resolve(x)
+				if err != nil {
+					return nil, err
+				}
+				arr[n] = value
+			}
+			return arr, nil
+		default:
+			return v, nil
+		}
+	}
+
+	parameters := make(map[string]interface{}, len(i.Parameters))
+	for k, v := range i.Parameters {
+		value, err := resolve(v)
+		if err != nil {
+			return fmt.Errorf("error in parameter %q of module %q – %v", k, i.Name, err)
+		}
+		if ref, ok := getModuleOutputReference(v); ok {
+			if i.parameterSources == nil {
+				i.parameterSources = make(map[string]string)
+			}
+			i.parameterSources[k] = "output " + ref
+		}
+		parameters[k] = value
+	}
+	i.Parameters = parameters
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package modules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModuleOutputs(t *testing.T) {
+	dbModule := `
+Kind: kubegen.k8s.io/Module.v1alpha2
+Parameters:
+- name: db_name
+  type: String
+  default: db
+Services:
+- name: { kubegen.String.Lookup: db_name }
+  port: 5432
+Outputs:
+- name: service_host
+  value:
+    kubegen.String.Join: [{ kubegen.String.Lookup: db_name }, .svc]
+`
+	tests := []struct {
+		bundle string
+		order  []string
+		args   string
+		err    string
+	}{
+		{
+			`
+Modules:
+- Name: app
+  SourceDir: modules/app
+  Parameters:
+    domain: { kubegen.FromModule: db.service_host }
+- Name: db
+  SourceDir: modules/db
+  Parameters:
+    db_name: users
+`,
+			[]string{"db", "app"},
+			"[--domain=users.svc]",
+			"",
+		},
+		{
+			`
+Parameters:
+  domain: { kubegen.FromModule: db.service_host }
+  db_name: users
+Modules:
+- Name: app
+  SourceDir: modules/app
+- Name: db
+  SourceDir: modules/db
+`,
+			[]string{"db", "app"},
+			"[--domain=users.svc]",
+			"",
+		},
+		{
+			`
+Modules:
+- Name: app
+  SourceDir: modules/app
+  Parameters:
+    domain: { kubegen.FromModule: db.service_port }
+- Name: db
+  SourceDir: modules/db
+`,
+			nil, "",
+			`error in parameter "domain" of module "app" – module "db" has no output "service_port"`,
+		},
+		{
+			`
+Modules:
+- Name: app
+  SourceDir: modules/app
+  Parameters:
+    domain: { kubegen.FromModule: database.service_host }
+- Name: db
+  SourceDir: modules/db
+`,
+			nil, "",
+			`module "app" refers to outputs of module "database", which is not defined (or not selected)`,
+		},
+		{
+			`
+Modules:
+- Name: app
+  SourceDir: modules/app
+  Parameters:
+    domain: { kubegen.FromModule: db }
+- Name: db
+  SourceDir: modules/db
+`,
+			nil, "",
+			`error in parameters of module "app" – invalid reference "db" in ` + "`kubegen.FromModule`" + `, expected "<module>.<output>"`,
+		},
+		{
+			`
+Modules:
+- Name: app
+  SourceDir: modules/app
+  Parameters:
+    domain: { kubegen.FromModule: db.service_host }
+- Name: db
+  SourceDir: modules/db
+- Name: db
+  SourceDir: modules/db
+  OutputDir: db2
+`,
+			nil, "",
+			`module "app" refers to outputs of module "db", which is defined more than once`,
+		},
+		{
+			`
+Modules:
+- Name: app
+  SourceDir: modules/app
+  Parameters:
+    domain: { kubegen.FromModule: db.service_host }
+- Name: db
+  SourceDir: modules/db
+  Parameters:
+    db_name: { kubegen.FromModule: app.host }
+`,
+			nil, "",
+			`cyclic dependency between outputs of modules [app → db → app]`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.err, func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{
+				"modules/app/app.yml": appModule,
+				"modules/db/db.yml":   dbModule,
+				"bundle.yml":          "Kind: kubegen.k8s.io/Bundle.v1alpha2\n" + test.bundle,
+			})
+			defer os.RemoveAll(dir)
+
+			bundle, err := NewBundle(filepath.Join(dir, "bundle.yml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = bundle.LoadModules(nil)
+			if test.err != "" {
+				if assert.Error(t, err) {
+					assert.Equal(t, test.err, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			order := []string{}
+			for _, m := range bundle.loadedModules {
+				order = append(order, m.instance.Name)
+			}
+			assert.Equal(t, test.order, order)
+
+			objs, err := generateObjects(bundle)
+			if err != nil {
+				t.Fatal(err)
+			}
+			deployment := findObject(objs, "Deployment", "app")
+			if assert.NotNil(t, deployment) {
+				assert.Equal(t, test.args, fmt.Sprintf("%v", firstContainer(deployment)["args"]))
+			}
+			assert.NotNil(t, findObject(objs, "Service", "users"))
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package modules
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/errordeveloper/kubegen/pkg/util"
+	"github.com/errordeveloper/kubegen/pkg/version"
+)
+
+const (
+	VersionAnnotation    = "kubegen.io/version"
+	SourceHashAnnotation = "kubegen.io/source-hash"
+)
+
+// AddProvenanceAnnotations makes each of the generated objects carry the version of kubegen and
+// the source hash of the module instance, so that a live object can be traced back to its source
+func (b *Bundle) AddProvenanceAnnotations() { b.provenanceAnnotations = true }
+
+// SourceHash is a checksum of all of the files in the module along with everything that is set for
+// the module instance, values of sensitive parameters are replaced with a digest, so that these are
+// not part of the input as they are, yet rotating a secret still changes the checksum
+func (m *Module) SourceHash(instance ModuleInstance) (string, error) {
+	hash, err := m.Hash()
+	if err != nil {
+		return "", err
+	}
+
+	sensitiveValues := make(map[string]bool)
+	for _, v := range m.sensitiveValues() {
+		sensitiveValues[v] = true
+	}
+
+	redact := func(values map[string]interface{}) map[string]interface{} {
+		redacted := make(map[string]interface{}, len(values))
+		for k, v := range values {
+			if s := fmt.Sprintf("%v", v); sensitiveValues[s] {
+				v = fmt.Sprintf("%s sha256:%x", util.Redacted, sha256.Sum256([]byte(s)))
+			}
+			redacted[k] = v
+		}
+		return redacted
+	}
+
+	// keys of the maps are sorted by encoding/json, so the checksum is deterministic
+	data, err := json.Marshal(struct {
+		Hash                    string
+		Name                    string
+		Namespace               string
+		NamePrefix              string
+		NameSuffix              string
+		Parameters              map[string]interface{}
+		Internals               map[string]interface{}
+		CommonLabels            map[string]string
+		CommonAnnotations       map[string]string
+		CommonLabelsInSelectors bool
+		Images                  []ImageOverride
+	}{
+		Hash:                    hash,
+		Name:                    instance.Name,
+		Namespace:               instance.Namespace,
+		NamePrefix:              instance.NamePrefix,
+		NameSuffix:              instance.NameSuffix,
+		Parameters:              redact(instance.Parameters),
+		Internals:               redact(instance.Internals),
+		CommonLabels:            instance.CommonLabels,
+		CommonAnnotations:       instance.CommonAnnotations,
+		CommonLabelsInSelectors: instance.CommonLabelsInSelectors,
+		Images:                  instance.Images,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data)), nil
+}
+
+// addProvenanceAnnotations sets annotations on each of the objects, but not on pod templates,
+// as changing those would cause all pods to be replaced whenever anything in the module changes
+func addProvenanceAnnotations(objs []object, sourceHash string) {
+	for _, obj := range objs {
+		metadata := getObject(obj, "metadata")
+		if metadata == nil {
+			metadata = make(object)
+			obj["metadata"] = metadata
+		}
+		annotations := getObject(metadata, "annotations")
+		if annotations == nil {
+			annotations = make(object)
+			metadata["annotations"] = annotations
+		}
+		annotations[VersionAnnotation] = version.Version
+		annotations[SourceHashAnnotation] = sourceHash
+	}
+}
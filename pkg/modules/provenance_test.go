@@ -0,0 +1,97 @@
+package modules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/errordeveloper/kubegen/pkg/version"
+)
+
+func TestProvenanceAnnotations(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"app/app.yml": appModule})
+	defer os.RemoveAll(dir)
+
+	generate := func(parameters map[string]interface{}) (*Bundle, []object) {
+		bundle := &Bundle{
+			Modules: []ModuleInstance{{
+				Name:       "app",
+				SourceDir:  filepath.Join(dir, "app"),
+				Parameters: parameters,
+			}},
+			omitVersion: true,
+		}
+		bundle.AddProvenanceAnnotations()
+		if err := bundle.LoadModules(nil); err != nil {
+			t.Fatal(err)
+		}
+		objs, err := generateObjects(bundle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bundle, objs
+	}
+	sourceHash := func(bundle *Bundle) string {
+		m := bundle.loadedModules[0]
+		hash, err := m.SourceHash(m.instance)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+
+	bundle, objs := generate(map[string]interface{}{"domain": "example.com"})
+	hash := sourceHash(bundle)
+	assert.Regexp(t, "^sha256:[0-9a-f]{64}$", hash)
+	if assert.NotEmpty(t, objs) {
+		for _, obj := range objs {
+			annotations := getObject(obj, "metadata", "annotations")
+			assert.Equal(t, hash, annotations[SourceHashAnnotation])
+			assert.Equal(t, version.Version, annotations[VersionAnnotation])
+		}
+	}
+	// pods would be replaced whenever anything changes in the module
+	app := findObject(objs, "Deployment", "app")
+	assert.Nil(t, getObject(app, "spec", "template", "metadata", "annotations")[SourceHashAnnotation])
+
+	// the header of the output carries the same hash
+	yaml, err := bundle.EncodeAllToYAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(yaml), fmt.Sprintf("#\tsourceHash: %q\n", hash))
+
+	bundle, _ = generate(map[string]interface{}{"domain": "example.org"})
+	assert.NotEqual(t, hash, sourceHash(bundle))
+
+	// values of sensitive parameters are replaced with a digest, so rotating a secret changes the hash
+	bundle, _ = generate(map[string]interface{}{"domain": "example.com", "token": "0p3n"})
+	hash = sourceHash(bundle)
+	bundle, objs = generate(map[string]interface{}{"domain": "example.com", "token": "s3cr3t"})
+	assert.NotEqual(t, hash, sourceHash(bundle))
+	for _, obj := range objs {
+		data, _ := json.Marshal(getObject(obj, "metadata"))
+		assert.NotContains(t, string(data), "s3cr3t")
+	}
+
+	// without the flag, objects are left as they are
+	bundle, err = loadBundle(ModuleInstance{
+		Name:       "app",
+		SourceDir:  filepath.Join(dir, "app"),
+		Parameters: map[string]interface{}{"domain": "example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, err = generateObjects(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range objs {
+		assert.Nil(t, getObject(obj, "metadata", "annotations")[SourceHashAnnotation])
+	}
+}
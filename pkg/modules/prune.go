@@ -0,0 +1,175 @@
+package modules
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	GeneratedFilesKind = "kubegen.k8s.io/GeneratedFiles.v1alpha1"
+	// GeneratedFilesName is the file in each output directory that records which files were generated,
+	// it's hidden and has no extension, so that tools that apply all manifests in a directory skip it
+	GeneratedFilesName = ".kubegen-generated"
+)
+
+// GeneratedFiles lists files that kubegen wrote to an output directory, relative to it
+type GeneratedFiles struct {
+	Kind  string   `yaml:"Kind" json:"Kind"`
+	Files []string `yaml:"Files" json:"Files"`
+}
+
+// outputDirFiles holds files generated in an output directory by a previous run, and by the current one
+type outputDirFiles struct {
+	previous, current []string
+}
+
+func readGeneratedFiles(dir string) ([]string, error) {
+	p := path.Join(dir, GeneratedFilesName)
+	data, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %q – %v", p, err)
+	}
+
+	generated := &GeneratedFiles{}
+	if err := yaml.Unmarshal(data, generated); err != nil {
+		return nil, fmt.Errorf("error loading %q – %v", p, err)
+	}
+	if generated.Kind != GeneratedFilesKind {
+		return nil, fmt.Errorf("error loading %q – unrecognised `Kind: %q`, must be %q", p, generated.Kind, GeneratedFilesKind)
+	}
+
+	files := []string{}
+	for _, file := range generated.Files {
+		// only files inside of the output directory can be removed
+		file = path.Clean(file)
+		if path.IsAbs(file) || file == ".." || strings.HasPrefix(file, "../") {
+			continue
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func writeGeneratedFiles(dir string, files []string) error {
+	sort.Strings(files)
+	data, err := yaml.Marshal(GeneratedFiles{Kind: GeneratedFilesKind, Files: files})
+	if err != nil {
+		return err
+	}
+	p := path.Join(dir, GeneratedFilesName)
+	if err := ioutil.WriteFile(p, data, 0644); err != nil {
+		return fmt.Errorf("error writing to file %q – %v", p, err)
+	}
+	return nil
+}
+
+// staleFiles returns files that were generated previously, but not by the current run, and still exist
+func (f *outputDirFiles) staleFiles(dir string) []string {
+	current := make(map[string]bool, len(f.current))
+	for _, file := range f.current {
+		current[file] = true
+	}
+
+	stale := []string{}
+	for _, file := range f.previous {
+		if current[file] {
+			continue
+		}
+		if _, err := os.Stat(path.Join(dir, file)); err != nil {
+			continue
+		}
+		stale = append(stale, file)
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// recordGeneratedFiles keeps track of the files written to the output directory, stale files remain
+// on record until these are pruned, so that it's possible to do that at any later point
+func (b *Bundle) recordGeneratedFiles(dir string, files []string) error {
+	previous, err := readGeneratedFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	if b.outputDirs == nil {
+		b.outputDirs = make(map[string]*outputDirFiles)
+	}
+	f := &outputDirFiles{previous: previous, current: files}
+	b.outputDirs[dir] = f
+
+	return writeGeneratedFiles(dir, append(f.staleFiles(dir), f.current...))
+}
+
+// Prune removes files from output directories that were generated previously, but not by the
+// last call to WriteToOutputDir, as well as any directories that are left empty, it returns
+// paths of the files, and with dryRun these are only listed instead of being removed
+func (b *Bundle) Prune(dryRun bool) ([]string, error) {
+	dirs := []string{}
+	for dir := range b.outputDirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	// when only some modules were selected, files of the others are not part of the
+	// current run, so any directories shared with those are left as they are
+	unselectedDirs := make(map[string]bool)
+	if b.selectedModulesOnly {
+		loaded := make(map[string]bool, len(b.loadedModules))
+		for _, m := range b.loadedModules {
+			loaded[m.instance.Name] = true
+		}
+		for _, i := range b.Modules {
+			if !loaded[i.Name] {
+				unselectedDirs[path.Clean(i.OutputDir)] = true
+			}
+		}
+	}
+
+	removedFiles := []string{}
+	for _, dir := range dirs {
+		if unselectedDirs[path.Clean(dir)] {
+			continue
+		}
+		f := b.outputDirs[dir]
+		for _, file := range f.staleFiles(dir) {
+			p := path.Join(dir, file)
+			removedFiles = append(removedFiles, p)
+			if dryRun {
+				continue
+			}
+			if err := os.Remove(p); err != nil {
+				return nil, fmt.Errorf("error removing stale file %q – %v", p, err)
+			}
+			removeEmptyDirs(dir, path.Dir(p))
+		}
+		if dryRun {
+			continue
+		}
+		if err := writeGeneratedFiles(dir, f.current); err != nil {
+			return nil, err
+		}
+	}
+
+	return removedFiles, nil
+}
+
+// removeEmptyDirs removes the directory and any of its parents up to the output directory, for as long as these are empty
+func removeEmptyDirs(outputDir, dir string) {
+	for filepath.Clean(dir) != filepath.Clean(outputDir) && dir != "." && dir != "/" {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = path.Dir(dir)
+	}
+}
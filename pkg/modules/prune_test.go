@@ -0,0 +1,92 @@
+package modules
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrune(t *testing.T) {
+	db := `
+Kind: kubegen.k8s.io/Module.v1alpha2
+Deployments:
+- name: db
+  containers: [{ name: db, image: "db:1" }]
+`
+	dir := writeFiles(t, map[string]string{
+		"app/app.yml":    appModule,
+		"app/db.yml":     db,
+		"out/notes.txt":  "not generated by kubegen\n",
+		"outside.yaml":   "not in the output directory\n",
+		"out/extra.yaml": "kind: List\n",
+	})
+	defer os.RemoveAll(dir)
+	outputDir := filepath.Join(dir, "out")
+
+	write := func(layout string) *Bundle {
+		bundle, err := loadBundle(ModuleInstance{
+			Name:       "app",
+			SourceDir:  filepath.Join(dir, "app"),
+			OutputDir:  outputDir,
+			Parameters: map[string]interface{}{"domain": "example.com"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bundle.SetOutputLayout(layout); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bundle.WriteToOutputDir("yaml"); err != nil {
+			t.Fatal(err)
+		}
+		return bundle
+	}
+	exists := func(file string) bool {
+		_, err := os.Stat(filepath.Join(outputDir, file))
+		return err == nil
+	}
+
+	bundle := write(LayoutPerKindDirectory)
+	removed, err := bundle.Prune(false)
+	assert.NoError(t, err)
+	assert.Empty(t, removed)
+
+	// a file outside of the output directory is never removed, even if it's on record
+	files, err := readGeneratedFiles(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeGeneratedFiles(outputDir, append(files, "../outside.yaml")); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Remove(filepath.Join(dir, "app", "db.yml"))
+	bundle = write(LayoutPerManifest)
+
+	// stale files remain on record until these are pruned
+	data, _ := ioutil.ReadFile(filepath.Join(outputDir, GeneratedFilesName))
+	assert.Equal(t, "Files:\n- app.yaml\n- deployment/app.yaml\n- deployment/db.yaml\nKind: "+GeneratedFilesKind+"\n", string(data))
+
+	removed, err = bundle.Prune(true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(outputDir, "deployment/app.yaml"),
+		filepath.Join(outputDir, "deployment/db.yaml"),
+	}, removed)
+	assert.True(t, exists("deployment/db.yaml"))
+
+	removed, err = bundle.Prune(false)
+	assert.NoError(t, err)
+	assert.Len(t, removed, 2)
+	assert.False(t, exists("deployment"), "empty directories must be removed")
+	assert.True(t, exists("app.yaml"))
+	assert.True(t, exists("notes.txt"))
+	assert.True(t, exists("extra.yaml"))
+	assert.True(t, exists("../outside.yaml"))
+
+	data, _ = ioutil.ReadFile(filepath.Join(outputDir, GeneratedFilesName))
+	assert.Equal(t, "Files:\n- app.yaml\nKind: "+GeneratedFilesKind+"\n", string(data))
+}
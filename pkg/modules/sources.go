@@ -0,0 +1,309 @@
+package modules
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	gitSourcePrefix  = "git+file://"
+	fileSourcePrefix = "file://"
+)
+
+// moduleSource is a module that has to be fetched into the cache before it can be loaded,
+// it's either a local git repository (e.g. "git+file:///srv/modules.git//sockshop?ref=v1.2.0")
+// or an archive (e.g. "file:///srv/modules.tar.gz//sockshop")
+type moduleSource struct {
+	uri    string
+	kind   string
+	path   string
+	subDir string
+	ref    string
+
+	// revision is either a commit or a checksum of the archive
+	revision string
+	dir      string
+}
+
+func parseModuleSource(uri string) (*moduleSource, error) {
+	s := &moduleSource{uri: uri}
+
+	invalidSourceError := func(reason string) error {
+		return fmt.Errorf("invalid module source %q – %s", uri, reason)
+	}
+
+	var rest string
+	switch {
+	case strings.HasPrefix(uri, gitSourcePrefix):
+		s.kind = "git"
+		rest = strings.TrimPrefix(uri, gitSourcePrefix)
+	case strings.HasPrefix(uri, fileSourcePrefix):
+		s.kind = "archive"
+		rest = strings.TrimPrefix(uri, fileSourcePrefix)
+	default:
+		return nil, invalidSourceError(fmt.Sprintf("only %q and %q are supported", gitSourcePrefix, fileSourcePrefix))
+	}
+
+	if n := strings.LastIndex(rest, "?"); n >= 0 {
+		query, err := url.ParseQuery(rest[n+1:])
+		if err != nil {
+			return nil, invalidSourceError(err.Error())
+		}
+		for k := range query {
+			if k != "ref" {
+				return nil, invalidSourceError(fmt.Sprintf("unknown option %q", k))
+			}
+		}
+		if s.kind != "git" {
+			return nil, invalidSourceError("`ref` can only be set for git repositories")
+		}
+		s.ref = query.Get("ref")
+		rest = rest[:n]
+	}
+
+	if rest == "" {
+		return nil, invalidSourceError("path must be set")
+	}
+
+	// leading slash belongs to the path, so look for the separator after it
+	if n := strings.Index(rest[1:], "//"); n >= 0 {
+		s.path, s.subDir = rest[:n+1], rest[n+3:]
+	} else {
+		s.path = rest
+	}
+
+	if !path.IsAbs(s.path) {
+		return nil, invalidSourceError("path must be absolute")
+	}
+	if s.subDir != "" && (path.IsAbs(s.subDir) || strings.HasPrefix(path.Clean(s.subDir), "..")) {
+		return nil, invalidSourceError("sub-directory must be within the repository or the archive")
+	}
+	if s.ref == "" {
+		s.ref = "HEAD"
+	}
+
+	return s, nil
+}
+
+// moduleSourceDir returns directory of the module instance, fetching it if
+// instance has `Source` set, otherwise `SourceDir` is relative to baseDir
+func moduleSourceDir(instance ModuleInstance, baseDir string) (string, *moduleSource, error) {
+	if instance.Source == "" {
+		if path.IsAbs(instance.SourceDir) {
+			return instance.SourceDir, nil, nil
+		}
+		return path.Join(baseDir, instance.SourceDir), nil, nil
+	}
+	if instance.SourceDir != "" {
+		return "", nil, fmt.Errorf("module %q must have either `Source` or `SourceDir` set, not both", instance.Name)
+	}
+	s, err := parseModuleSource(instance.Source)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.fetch(); err != nil {
+		return "", nil, err
+	}
+	return s.dir, s, nil
+}
+
+// SourceCacheDir is where the modules get fetched to, it can be set with KUBEGEN_CACHE_DIR
+func SourceCacheDir() string {
+	if dir := os.Getenv("KUBEGEN_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return path.Join(dir, "kubegen")
+	}
+	return path.Join(os.Getenv("HOME"), ".cache", "kubegen")
+}
+
+// fetch obtains contents of the repository or the archive and stores it in the cache,
+// contents is stored by the revision, so anything that's in the cache already is reused
+func (s *moduleSource) fetch() error {
+	var (
+		data []byte
+		err  error
+	)
+
+	switch s.kind {
+	case "git":
+		data, err = s.fetchGit()
+	case "archive":
+		data, err = ioutil.ReadFile(s.path)
+		if err == nil {
+			s.revision = fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error fetching module source %q – %v", s.uri, err)
+	}
+
+	revisionDir := path.Join(SourceCacheDir(), "sources", fmt.Sprintf("%x", sha256.Sum256([]byte(s.kind+" "+s.path+" "+s.revision))))
+
+	if _, err := os.Stat(revisionDir); os.IsNotExist(err) {
+		if err := s.extract(data, revisionDir); err != nil {
+			return fmt.Errorf("error fetching module source %q – %v", s.uri, err)
+		}
+	}
+
+	s.dir = path.Join(revisionDir, s.subDir)
+
+	if info, err := os.Stat(s.dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("error fetching module source %q – %q is not a directory", s.uri, s.subDir)
+	}
+
+	return nil
+}
+
+func (s *moduleSource) fetchGit() ([]byte, error) {
+	git := func(args ...string) ([]byte, error) {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		cmd := exec.Command("git", append([]string{"-C", s.path}, args...)...)
+		cmd.Stdout, cmd.Stderr = stdout, stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("git %s: %v (%s)", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+		}
+		return stdout.Bytes(), nil
+	}
+
+	revision, err := git("rev-parse", "--verify", s.ref+"^{commit}")
+	if err != nil {
+		return nil, err
+	}
+	s.revision = strings.TrimSpace(string(revision))
+
+	return git("archive", "--format=tar", s.revision)
+}
+
+// extract unpacks the archive into a temporary directory first, so that
+// an interrupted extraction never looks like a complete one
+func (s *moduleSource) extract(data []byte, dir string) error {
+	if err := os.MkdirAll(path.Dir(dir), 0755); err != nil {
+		return err
+	}
+
+	tmpDir, err := ioutil.TempDir(path.Dir(dir), ".fetch-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	switch {
+	case s.kind == "git" || strings.HasSuffix(s.path, ".tar"):
+		err = extractTar(bytes.NewReader(data), tmpDir)
+	case strings.HasSuffix(s.path, ".tar.gz") || strings.HasSuffix(s.path, ".tgz"):
+		var r *gzip.Reader
+		if r, err = gzip.NewReader(bytes.NewReader(data)); err == nil {
+			err = extractTar(r, tmpDir)
+		}
+	case strings.HasSuffix(s.path, ".zip"):
+		err = extractZip(data, tmpDir)
+	default:
+		err = fmt.Errorf("unknown archive format, only \".tar\", \".tar.gz\", \".tgz\" and \".zip\" are supported")
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpDir, dir); err != nil {
+		// another process may have fetched the same revision meanwhile
+		if _, statErr := os.Stat(dir); statErr == nil {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func archiveEntryPath(dir, name string) (string, error) {
+	p := filepath.Join(dir, filepath.FromSlash(name))
+	if p != dir && !strings.HasPrefix(p, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("archive entry %q is outside of the archive", name)
+	}
+	return p, nil
+}
+
+func writeArchiveEntry(p string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		p, err := archiveEntryPath(dir, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(p, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := writeArchiveEntry(p, tr); err != nil {
+				return err
+			}
+		}
+		// links and other special files are not needed by modules, so these are ignored
+	}
+}
+
+func extractZip(data []byte, dir string) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	for _, file := range zr.File {
+		p, err := archiveEntryPath(dir, file.Name)
+		if err != nil {
+			return err
+		}
+		if file.FileInfo().IsDir() {
+			if err := os.MkdirAll(p, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		r, err := file.Open()
+		if err != nil {
+			return err
+		}
+		err = writeArchiveEntry(p, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package modules
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// gitRepo creates a repository with the app module, tagged v1, and a later commit that changes the default image
+func gitRepo(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo, err := ioutil.TempDir("", "kubegen-modules-test-repo-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v (%s)", args, err, out)
+		}
+	}
+	commit := func(image string) {
+		if err := os.MkdirAll(filepath.Join(repo, "app"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		data := strings.Replace(appModule, "default: app:1", "default: "+image, 1)
+		if err := ioutil.WriteFile(filepath.Join(repo, "app", "app.yml"), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", "-A")
+		git("commit", "-q", "-m", image)
+	}
+	git("init", "-q")
+	commit("app:1")
+	git("tag", "v1")
+	commit("app:2")
+	return repo
+}
+
+func TestModuleSources(t *testing.T) {
+	repo := gitRepo(t)
+	defer os.RemoveAll(repo)
+
+	cacheDir, err := ioutil.TempDir("", "kubegen-modules-test-cache-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+	defer os.Setenv("KUBEGEN_CACHE_DIR", os.Getenv("KUBEGEN_CACHE_DIR"))
+	os.Setenv("KUBEGEN_CACHE_DIR", cacheDir)
+
+	base := fmt.Sprintf(`
+Kind: kubegen.k8s.io/Bundle.v1alpha2
+Parameters:
+  domain: example.com
+Modules:
+- Name: app
+  Source: git+file://%s//app?ref=v1
+`, repo)
+
+	tests := []struct {
+		bundle string
+		image  string
+		err    string
+	}{
+		{"", "app:1", ""},
+		{"Modules:\n- Name: app\n  Parameters:\n    domain: prod.example.com", "app:1", ""},
+		{fmt.Sprintf("Modules:\n- Name: app\n  Source: git+file://%s//app", repo), "app:2", ""},
+		{"Modules:\n- Name: app\n  SourceDir: modules/app", "app:3", ""},
+		{fmt.Sprintf("Modules:\n- Name: app\n  SourceDir: %s/modules/app", cacheDir), "app:4", ""},
+		{
+			fmt.Sprintf("Modules:\n- Name: app\n  Source: git+file://%s//app?ref=v2", repo),
+			"",
+			"error fetching module source",
+		},
+		{
+			fmt.Sprintf("Modules:\n- Name: app\n  Source: git+file://%s//app\n  SourceDir: modules/app", repo),
+			"",
+			"module \"app\" must have either `Source` or `SourceDir` set, not both",
+		},
+		{
+			"Modules:\n- Name: app\n  Source: git+file://modules.git//app",
+			"",
+			`invalid module source "git+file://modules.git//app" – path must be absolute`,
+		},
+		{
+			"Modules:\n- Name: app\n  Source: https://example.com/modules.git",
+			"",
+			`invalid module source "https://example.com/modules.git" – only "git+file://" and "file://" are supported`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.bundle, func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{
+				"base.yml":            base,
+				"modules/app/app.yml": strings.Replace(appModule, "default: app:1", "default: app:3", 1),
+				"bundle.yml":          "Kind: kubegen.k8s.io/Bundle.v1alpha2\nExtends: base.yml\n" + test.bundle,
+			})
+			defer os.RemoveAll(dir)
+			if err := os.MkdirAll(filepath.Join(cacheDir, "modules/app"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(cacheDir, "modules/app/app.yml"), []byte(strings.Replace(appModule, "default: app:1", "default: app:4", 1)), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			bundle, err := NewBundle(filepath.Join(dir, "bundle.yml"))
+			if err == nil {
+				bundle.omitVersion = true
+				err = bundle.LoadModules(nil)
+			}
+			if test.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			objs, err := generateObjects(bundle)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if assert.Len(t, objs, 1) {
+				assert.Equal(t, test.image, firstContainer(objs[0])["image"])
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package modules
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/errordeveloper/kubegen/pkg/util"
+)
+
+// Styles of the output, i.e. how objects generated from each of the manifests are put together
+const (
+	// YAMLStyleList wraps the objects in a `kind: List` (default)
+	YAMLStyleList = "list"
+	// YAMLStyleStream writes each of the objects as a separate document, in the same order as the list
+	YAMLStyleStream = "stream"
+	// JSONStyleList wraps the objects in a `kind: List` (default)
+	JSONStyleList = "list"
+	// JSONStyleNDJSON writes each of the objects on a line of its own, so that the output of all
+	// modules can be concatenated, which is not the case for lists
+	JSONStyleNDJSON = "ndjson"
+)
+
+var (
+	YAMLStyles = []string{YAMLStyleList, YAMLStyleStream}
+	JSONStyles = []string{JSONStyleList, JSONStyleNDJSON}
+)
+
+// SetYAMLStyle sets how objects are put together in YAML output, it doesn't
+// apply to layouts where each of the objects is written to a file of its own
+func (b *Bundle) SetYAMLStyle(style string) error {
+	for _, s := range YAMLStyles {
+		if s == style {
+			b.yamlStyle = style
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown YAML style %q, must be one of %q", style, YAMLStyles)
+}
+
+// SetJSONStyle sets how objects are put together in JSON output, it doesn't
+// apply to layouts where each of the objects is written to a file of its own
+func (b *Bundle) SetJSONStyle(style string) error {
+	for _, s := range JSONStyles {
+		if s == style {
+			b.jsonStyle = style
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown JSON style %q, must be one of %q", style, JSONStyles)
+}
+
+// encodeYAMLStream encodes each of the items as a separate YAML document, the first one doesn't
+// start with a separator, as that's expected to come along with the header
+func (m *Module) encodeYAMLStream(list *metav1.List) ([]byte, error) {
+	output := []byte{}
+	for n, item := range list.Items {
+		data, err := util.Encode(item.Object, "application/yaml", false)
+		if err != nil {
+			return nil, m.redactError(err)
+		}
+
+		if data, err = m.maskSensitiveValuesInOutput("application/yaml", data, false); err != nil {
+			return nil, err
+		}
+
+		if n > 0 {
+			output = append(output, []byte("---\n")...)
+		}
+		output = append(output, data...)
+	}
+	return output, nil
+}
+
+// encodeNDJSON encodes each of the items as JSON on a single line
+func (m *Module) encodeNDJSON(list *metav1.List) ([]byte, error) {
+	output := []byte{}
+	for _, item := range list.Items {
+		data, err := util.Encode(item.Object, "application/json", false)
+		if err != nil {
+			return nil, m.redactError(err)
+		}
+
+		if data, err = m.maskSensitiveValuesInOutput("application/json", data, false); err != nil {
+			return nil, err
+		}
+
+		output = append(append(output, data...), byte('\n'))
+	}
+	return output, nil
+}
@@ -0,0 +1,106 @@
+package modules
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputStyles(t *testing.T) {
+	db := `
+Kind: kubegen.k8s.io/Module.v1alpha2
+Deployments:
+- name: db
+  containers: [{ name: db, image: "db:1" }]
+Services:
+- name: db
+  ports: [{ name: db, port: 5432 }]
+`
+	dir := writeFiles(t, map[string]string{
+		"app/app.yml": appModule,
+		"app/db.yml":  db,
+	})
+	defer os.RemoveAll(dir)
+
+	load := func(yamlStyle, jsonStyle string) *Bundle {
+		bundle := &Bundle{
+			Modules: []ModuleInstance{{
+				Name:       "app",
+				SourceDir:  filepath.Join(dir, "app"),
+				Parameters: map[string]interface{}{"domain": "example.com", "token": "s3cr3t"},
+			}},
+			omitVersion: true,
+		}
+		if err := bundle.SetYAMLStyle(yamlStyle); err != nil {
+			t.Fatal(err)
+		}
+		if err := bundle.SetJSONStyle(jsonStyle); err != nil {
+			t.Fatal(err)
+		}
+		if err := bundle.LoadModules(nil); err != nil {
+			t.Fatal(err)
+		}
+		return bundle
+	}
+	kinds := func(documents []string) []string {
+		kinds := []string{}
+		for _, document := range documents {
+			for _, line := range strings.Split(document, "\n") {
+				if strings.HasPrefix(line, "kind: ") {
+					kinds = append(kinds, strings.TrimPrefix(line, "kind: "))
+				}
+			}
+		}
+		return kinds
+	}
+
+	list, err := load(YAMLStyleList, JSONStyleList).EncodeAllToYAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	documents := strings.Split(string(list), "\n---\n")[1:]
+	assert.Equal(t, []string{"List", "List"}, kinds(documents))
+
+	stream, err := load(YAMLStyleStream, JSONStyleList).EncodeAllToYAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	documents = strings.Split(string(stream), "\n---\n")[1:]
+	// each of the manifests still starts with a header, and objects are in the same order as in the list
+	assert.Equal(t, []string{"Deployment", "Deployment", "Service"}, kinds(documents))
+	assert.Contains(t, documents[0], "#\tmanifestPath: ")
+	assert.Contains(t, documents[1], "#\tmanifestPath: ")
+	assert.NotContains(t, documents[2], "#\tmanifestPath: ")
+	assert.Equal(t, strings.Count(string(list), "hunter2"), strings.Count(string(stream), "hunter2"))
+	assert.NotContains(t, string(stream), "s3cr3t")
+
+	list, err = load(YAMLStyleList, JSONStyleList).EncodeAllToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj := object{}
+	assert.NoError(t, json.NewDecoder(bytes.NewReader(list)).Decode(&obj))
+	assert.Equal(t, "List", obj["kind"])
+
+	ndjson, err := load(YAMLStyleList, JSONStyleNDJSON).EncodeAllToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(ndjson), "\n"), "\n")
+	if assert.Len(t, lines, 3) {
+		for n, kind := range []string{"Deployment", "Deployment", "Service"} {
+			obj := object{}
+			if assert.NoError(t, json.Unmarshal([]byte(lines[n]), &obj)) {
+				assert.Equal(t, kind, obj["kind"])
+			}
+		}
+	}
+
+	assert.EqualError(t, (&Bundle{}).SetYAMLStyle("flow"), `unknown YAML style "flow", must be one of ["list" "stream"]`)
+	assert.EqualError(t, (&Bundle{}).SetJSONStyle("jsonl"), `unknown JSON style "jsonl", must be one of ["list" "ndjson"]`)
+}
@@ -0,0 +1,181 @@
+package modules
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pmezard/go-difflib/difflib"
+
+	"github.com/errordeveloper/kubegen/pkg/util"
+)
+
+const (
+	ModuleTestsKind = "kubegen.k8s.io/ModuleTests.v1alpha2"
+	// TestsDirName is the directory in a module that holds the tests along with
+	// the expected outputs, it's not considered part of the module itself
+	TestsDirName = "tests"
+)
+
+// ModuleTestsFileNames are the names the list of tests can have in the tests directory, only one of them may exist
+var ModuleTestsFileNames = []string{"kubegen-tests.yml", "kubegen-tests.yaml", "kubegen-tests.json", "kubegen-tests.hcl"}
+
+// ModuleTests lists sets of parameters to generate the module with, and files with expected outputs
+type ModuleTests struct {
+	Kind  string       `yaml:"Kind" json:"Kind" hcl:"kind"`
+	Tests []ModuleTest `yaml:"Tests" json:"Tests" hcl:"test"`
+
+	// path of the file the tests were loaded from
+	path string
+}
+
+type ModuleTest struct {
+	Name       string                 `yaml:"name" json:"name" hcl:",key"`
+	Namespace  string                 `yaml:"namespace,omitempty" json:"namespace,omitempty" hcl:"namespace"`
+	Parameters map[string]interface{} `yaml:"parameters,omitempty" json:"parameters,omitempty" hcl:"parameters"`
+	// Format of the output is either "yaml" (default) or "json"
+	Format string `yaml:"format,omitempty" json:"format,omitempty" hcl:"format"`
+	// Expected is the file with expected output, relative to the tests directory ("<name>.<format>" by default)
+	Expected string `yaml:"expected,omitempty" json:"expected,omitempty" hcl:"expected"`
+}
+
+// ModuleTestResult holds outputs of a test, Expected is nil if the file doesn't exist yet
+type ModuleTestResult struct {
+	Test         ModuleTest
+	ExpectedPath string
+	Expected     []byte
+	Actual       []byte
+	Warnings     []string
+}
+
+// LoadModuleTests reads the list of tests from the tests directory of the module, it returns nil if there isn't one
+func LoadModuleTests(dir string) (*ModuleTests, error) {
+	var tests *ModuleTests
+
+	for _, name := range ModuleTestsFileNames {
+		p := path.Join(dir, TestsDirName, name)
+		data, err := ioutil.ReadFile(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading module tests %q – %v", p, err)
+		}
+		if tests != nil {
+			return nil, fmt.Errorf("module %q must have only one list of tests, found %q and %q", dir, tests.path, p)
+		}
+		tests = &ModuleTests{path: p}
+		if err := util.LoadObj(tests, data, p, ""); err != nil {
+			return nil, err
+		}
+		if tests.Kind != ModuleTestsKind {
+			return nil, fmt.Errorf(
+				"error loading module tests %q – unrecognised `Kind: %q`, must be %q",
+				p, tests.Kind, ModuleTestsKind)
+		}
+	}
+
+	if tests == nil {
+		return nil, nil
+	}
+
+	names := make(map[string]bool, len(tests.Tests))
+	for n, test := range tests.Tests {
+		if test.Name == "" {
+			return nil, fmt.Errorf("error loading module tests %q – test #%d must have a name", tests.path, n)
+		}
+		if names[test.Name] {
+			return nil, fmt.Errorf("error loading module tests %q – test %q is defined more than once", tests.path, test.Name)
+		}
+		names[test.Name] = true
+
+		switch test.Format {
+		case "":
+			tests.Tests[n].Format = "yaml"
+		case "yaml", "json":
+		default:
+			return nil, fmt.Errorf("error loading module tests %q – test %q has unknown format %q, must be \"yaml\" or \"json\"",
+				tests.path, test.Name, test.Format)
+		}
+		if test.Expected == "" {
+			tests.Tests[n].Expected = test.Name + "." + tests.Tests[n].Format
+		}
+	}
+
+	return tests, nil
+}
+
+// Run generates the module in dir with parameters of the test and reads the expected output, paths
+// of the manifests are part of the output, so dir should be the same every time (e.g. ".")
+func (t ModuleTest) Run(dir string) (*ModuleTestResult, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	instance := ModuleInstance{
+		Name:       path.Base(filepath.ToSlash(absDir)),
+		SourceDir:  dir,
+		Namespace:  t.Namespace,
+		Parameters: t.Parameters,
+	}
+
+	// version of kubegen is left out of the header, so that expected outputs don't change with every release
+	bundle := &Bundle{Modules: []ModuleInstance{instance}, omitVersion: true}
+	if err := bundle.LoadModules(nil); err != nil {
+		return nil, fmt.Errorf("test %q failed – %v", t.Name, err)
+	}
+
+	result := &ModuleTestResult{
+		Test:         t,
+		ExpectedPath: path.Join(dir, TestsDirName, t.Expected),
+		Warnings:     bundle.Warnings(),
+	}
+
+	switch t.Format {
+	case "json":
+		result.Actual, err = bundle.EncodeAllToJSON()
+	default:
+		result.Actual, err = bundle.EncodeAllToYAML()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("test %q failed – %v", t.Name, err)
+	}
+
+	result.Expected, err = ioutil.ReadFile(result.ExpectedPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading expected output of test %q – %v", t.Name, err)
+	}
+
+	return result, nil
+}
+
+func (r *ModuleTestResult) Passed() bool {
+	return r.Expected != nil && bytes.Equal(r.Expected, r.Actual)
+}
+
+// Diff returns a unified diff between the expected and the actual output
+func (r *ModuleTestResult) Diff() (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(r.Expected)),
+		B:        difflib.SplitLines(string(r.Actual)),
+		FromFile: r.ExpectedPath,
+		ToFile:   "actual output",
+		Context:  3,
+	})
+}
+
+// Update writes the actual output to the file with expected output
+func (r *ModuleTestResult) Update() error {
+	if err := os.MkdirAll(path.Dir(r.ExpectedPath), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(r.ExpectedPath, r.Actual, 0644); err != nil {
+		return fmt.Errorf("error writing expected output of test %q – %v", r.Test.Name, err)
+	}
+	r.Expected = r.Actual
+	return nil
+}
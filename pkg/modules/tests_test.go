@@ -0,0 +1,121 @@
+package modules
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModuleTests(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"app/app.yml": appModule,
+		"app/tests/kubegen-tests.yml": `
+Kind: kubegen.k8s.io/ModuleTests.v1alpha2
+Tests:
+- name: default
+  parameters: { domain: example.com }
+- name: staging
+  namespace: staging
+  parameters: { domain: staging.example.com, image: "app:2" }
+  format: json
+  expected: app-staging.json
+`,
+		// expected outputs may look like manifests, but these are not part of the module
+		"app/tests/default.yaml": "Kind: kubegen.k8s.io/Module.v1alpha2\n",
+	})
+	defer os.RemoveAll(dir)
+	moduleDir := filepath.Join(dir, "app")
+
+	tests, err := LoadModuleTests(moduleDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, tests.Tests, 2) {
+		assert.Equal(t, "yaml", tests.Tests[0].Format)
+		assert.Equal(t, "default.yaml", tests.Tests[0].Expected)
+		assert.Equal(t, "app-staging.json", tests.Tests[1].Expected)
+	}
+
+	for _, test := range tests.Tests {
+		result, err := test.Run(moduleDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.False(t, result.Passed(), test.Name)
+		diff, err := result.Diff()
+		assert.NoError(t, err)
+		assert.Contains(t, diff, "+++ actual output")
+
+		if err := result.Update(); err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, result.Passed())
+
+		result, err = test.Run(moduleDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, result.Passed(), test.Name)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(moduleDir, "tests", "app-staging.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(data), `"namespace": "staging"`)
+	assert.Contains(t, string(data), `"image": "app:2"`)
+
+	// a change to the module makes the tests fail
+	if err := ioutil.WriteFile(filepath.Join(moduleDir, "app.yml"),
+		[]byte(strings.Replace(appModule, "--domain=", "--hostname=", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := tests.Tests[0].Run(moduleDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, result.Passed())
+	diff, _ := result.Diff()
+	assert.Contains(t, diff, "+          - --hostname=example.com")
+
+	// a test that fails to generate the module is reported as an error
+	if _, err := (ModuleTest{Name: "missing", Format: "yaml", Expected: "missing.yaml"}).Run(moduleDir); assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `test "missing" failed – `)
+	}
+
+	tests, err = LoadModuleTests(dir)
+	assert.NoError(t, err)
+	assert.Nil(t, tests)
+}
+
+func TestLoadModuleTestsErrors(t *testing.T) {
+	tests := map[string]string{
+		"Kind: kubegen.k8s.io/ModuleTests.v1alpha1\n":                                     "unrecognised `Kind: \"kubegen.k8s.io/ModuleTests.v1alpha1\"`",
+		"Kind: kubegen.k8s.io/ModuleTests.v1alpha2\nTests: [{ parameters: {} }]\n":        "test #0 must have a name",
+		"Kind: kubegen.k8s.io/ModuleTests.v1alpha2\nTests: [{ name: a }, { name: a }]\n":  `test "a" is defined more than once`,
+		"Kind: kubegen.k8s.io/ModuleTests.v1alpha2\nTests: [{ name: a, format: toml }]\n": `test "a" has unknown format "toml", must be "yaml" or "json"`,
+	}
+	for manifest, message := range tests {
+		dir := writeFiles(t, map[string]string{"tests/kubegen-tests.yml": manifest})
+		defer os.RemoveAll(dir)
+
+		_, err := LoadModuleTests(dir)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), message)
+		}
+	}
+
+	dir := writeFiles(t, map[string]string{
+		"tests/kubegen-tests.yml":  "Kind: kubegen.k8s.io/ModuleTests.v1alpha2\n",
+		"tests/kubegen-tests.json": `{"Kind": "kubegen.k8s.io/ModuleTests.v1alpha2"}`,
+	})
+	defer os.RemoveAll(dir)
+	_, err := LoadModuleTests(dir)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "must have only one list of tests")
+	}
+}
@@ -0,0 +1,130 @@
+package modules
+
+import (
+	"encoding/json"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/errordeveloper/kubegen/pkg/util"
+)
+
+// object is a generic representation of any of the generated objects, which
+// makes it possible to modify these regardless of their kind
+type object = map[string]interface{}
+
+// transformObjects converts each of the objects in the lists to generic representation,
+// passes all of them to the transform function and converts them back
+func transformObjects(lists map[ManifestPath]*metav1.List, transform func([]object) error) error {
+	// objects are put back in the same order, so the lists have to be in a stable order
+	manifestPaths := []ManifestPath{}
+	for manifestPath := range lists {
+		manifestPaths = append(manifestPaths, manifestPath)
+	}
+	sort.Strings(manifestPaths)
+
+	objs := []object{}
+	for _, manifestPath := range manifestPaths {
+		for _, item := range lists[manifestPath].Items {
+			data, err := json.Marshal(item.Object)
+			if err != nil {
+				return err
+			}
+			obj := make(object)
+			if err := json.Unmarshal(data, &obj); err != nil {
+				return err
+			}
+			objs = append(objs, obj)
+		}
+	}
+
+	if err := transform(objs); err != nil {
+		return err
+	}
+
+	n := 0
+	for _, manifestPath := range manifestPaths {
+		list := lists[manifestPath]
+		for i := range list.Items {
+			data, err := json.Marshal(objs[n])
+			if err != nil {
+				return err
+			}
+			obj, err := util.Decode(data)
+			if err != nil {
+				return err
+			}
+			list.Items[i] = runtime.RawExtension{Object: obj}
+			n++
+		}
+	}
+
+	return nil
+}
+
+// getObject returns a nested object by its keys, or nil if it's not set
+func getObject(obj object, keys ...string) object {
+	for _, k := range keys {
+		if obj == nil {
+			return nil
+		}
+		obj, _ = obj[k].(map[string]interface{})
+	}
+	return obj
+}
+
+// getObjects returns a nested list of objects by its keys, any items that are not objects are omitted
+func getObjects(obj object, keys ...string) []object {
+	parent := getObject(obj, keys[:len(keys)-1]...)
+	if parent == nil {
+		return nil
+	}
+	items, _ := parent[keys[len(keys)-1]].([]interface{})
+	objs := []object{}
+	for _, item := range items {
+		if itemObj, ok := item.(map[string]interface{}); ok {
+			objs = append(objs, itemObj)
+		}
+	}
+	return objs
+}
+
+func getKind(obj object) string {
+	kind, _ := obj["kind"].(string)
+	return kind
+}
+
+func getName(obj object) string {
+	name, _ := getObject(obj, "metadata")["name"].(string)
+	return name
+}
+
+// getPodSpec returns pod spec of a pod or a pod controller, or nil for any other kind
+func getPodSpec(obj object) object {
+	switch getKind(obj) {
+	case "Pod":
+		return getObject(obj, "spec")
+	case "Deployment", "ReplicaSet", "DaemonSet", "StatefulSet", "ReplicationController", "Job":
+		return getObject(obj, "spec", "template", "spec")
+	case "CronJob":
+		return getObject(obj, "spec", "jobTemplate", "spec", "template", "spec")
+	}
+	return nil
+}
+
+// getPodTemplateMetadata returns metadata of the pod template of a pod controller
+func getPodTemplateMetadata(obj object) object {
+	switch getKind(obj) {
+	case "Deployment", "ReplicaSet", "DaemonSet", "StatefulSet", "ReplicationController", "Job":
+		return getObject(obj, "spec", "template", "metadata")
+	case "CronJob":
+		return getObject(obj, "spec", "jobTemplate", "spec", "template", "metadata")
+	}
+	return nil
+}
+
+// getContainers returns all containers and init containers in the pod spec
+func getContainers(podSpec object) []object {
+	return append(getObjects(podSpec, "initContainers"), getObjects(podSpec, "containers")...)
+}
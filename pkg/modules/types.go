@@ -10,22 +10,54 @@ const (
 )
 
 type Bundle struct {
-	Kind          string           `yaml:"Kind" json:"Kind" hcl:"kind"`
-	Name          string           `yaml:"Name" json:"Name" hcl:"name"`
-	Namespace     string           `yaml:"Namespace,omitempty" json:"Namespace,omitempty" hcl:"namespace"`
-	Description   string           `yaml:"Description,omitempty" json:"Description" hcl:"description"`
-	Modules       []ModuleInstance `yaml:"Modules" "json:"Modules" hcl:"module"`
-	path          string           `yaml:"-" json:"-" hcl:"-"`
-	loadedModules []Module         `yaml:"-" json:"-" hcl:"-"`
+	Kind          string                 `yaml:"Kind" json:"Kind" hcl:"kind"`
+	Extends       string                 `yaml:"Extends,omitempty" json:"Extends,omitempty" hcl:"extends"`
+	Name          string                 `yaml:"Name" json:"Name" hcl:"name"`
+	Namespace     string                 `yaml:"Namespace,omitempty" json:"Namespace,omitempty" hcl:"namespace"`
+	Description   string                 `yaml:"Description,omitempty" json:"Description" hcl:"description"`
+	Modules       []ModuleInstance       `yaml:"Modules" "json:"Modules" hcl:"module"`
+	Parameters    map[string]interface{} `yaml:"Parameters,omitempty" json:"Parameters,omitempty" hcl:"parameters"`
+	path          string                 `yaml:"-" json:"-" hcl:"-"`
+	loadedModules []Module               `yaml:"-" json:"-" hcl:"-"`
+
+	CommonLabels            map[string]string `yaml:"CommonLabels,omitempty" json:"CommonLabels,omitempty" hcl:"common_labels"`
+	CommonAnnotations       map[string]string `yaml:"CommonAnnotations,omitempty" json:"CommonAnnotations,omitempty" hcl:"common_annotations"`
+	CommonLabelsInSelectors bool              `yaml:"CommonLabelsInSelectors,omitempty" json:"CommonLabelsInSelectors,omitempty" hcl:"common_labels_in_selectors"`
+	Images                  []ImageOverride   `yaml:"Images,omitempty" json:"Images,omitempty" hcl:"image"`
+
+	maskSensitiveValues       bool
+	selectedModulesOnly       bool
+	allowUndeclaredParameters bool
+	undeclaredParameters      []string
+	outputLayout              string
+	outputDirs                map[string]*outputDirFiles
+	provenanceAnnotations     bool
+	omitVersion               bool
+	yamlStyle                 string
+	jsonStyle                 string
 }
 
 type ModuleInstance struct {
 	Name       string                 `yaml:"Name" json:"Name" hcl:",key"`
 	Namespace  string                 `yaml:"Namespace,omitempty" json:"Namespace,omitempty" hcl:"namespace"`
+	Source     string                 `yaml:"Source,omitempty" json:"Source,omitempty" hcl:"source"`
 	SourceDir  string                 `yaml:"SourceDir" json:"SourceDir" hcl:"source_dir"`
 	OutputDir  string                 `yaml:"OutputDir" json:"OutputDir" hcl:"output_dir"`
+	NamePrefix string                 `yaml:"NamePrefix,omitempty" json:"NamePrefix,omitempty" hcl:"name_prefix"`
+	NameSuffix string                 `yaml:"NameSuffix,omitempty" json:"NameSuffix,omitempty" hcl:"name_suffix"`
 	Parameters map[string]interface{} `yaml:"Parameters,omitempty" json:"Parameters,omitempty" hcl:"parameters"`
 	Internals  map[string]interface{} `yaml:"Internals,omitempty" json:"Internals,omitempty" hcl:"internals"`
+	Remove     bool                   `yaml:"Remove,omitempty" json:"Remove,omitempty" hcl:"remove"`
+
+	CommonLabels            map[string]string `yaml:"CommonLabels,omitempty" json:"CommonLabels,omitempty" hcl:"common_labels"`
+	CommonAnnotations       map[string]string `yaml:"CommonAnnotations,omitempty" json:"CommonAnnotations,omitempty" hcl:"common_annotations"`
+	CommonLabelsInSelectors bool              `yaml:"CommonLabelsInSelectors,omitempty" json:"CommonLabelsInSelectors,omitempty" hcl:"common_labels_in_selectors"`
+	Images                  []ImageOverride   `yaml:"Images,omitempty" json:"Images,omitempty" hcl:"image"`
+
+	// parameterSources tracks parameters inherited from the bundle
+	parameterSources map[string]string
+	// includedBy is set for instances of sub-modules
+	includedBy ManifestPath
 }
 
 type valueLookupFunc func() []byte
@@ -37,11 +69,38 @@ type Module struct {
 	Parameters []ModuleParameter `yaml:"Parameters,omitempty" json:"Parameters,omitempty" hcl:"parameter"`
 	Internals  []ModuleInternal  `yaml:"Internals,omitempty" json:"Internals,omitempty" hcl:"internals"`
 	Resources  []AnyResource     `yaml:"Resources" json:"Resources" hcl:"resource"`
+	Modules    []ModuleInstance  `yaml:"Modules,omitempty" json:"Modules,omitempty" hcl:"module"`
+	Outputs    []ModuleOutput    `yaml:"Outputs,omitempty" json:"Outputs,omitempty" hcl:"output"`
+	// MergeKeys override keys that elements of arrays of objects are matched by, when an object
+	// is looked up and merged with another one, these apply to all of the manifests in the module
+	MergeKeys []string `yaml:"MergeKeys,omitempty" json:"MergeKeys,omitempty" hcl:"merge_keys"`
 
 	directory  string
+	instance   ModuleInstance
+	source     *moduleSource
 	attributes map[AttributeKey]attribute
+	outputs    map[string]interface{}
 	manifests  map[ManifestPath][]byte
 	resources  map[ManifestPath][]resources.Anything
+
+	// temporaryAttributes are bound by kubegen.Array.ForEach
+	temporaryAttributes []AttributeKey
+
+	maskSensitiveValues bool
+	// inheritedSensitiveValues come from the parent module, as those may be passed to a sub-module
+	inheritedSensitiveValues []string
+	// matchedImages are names of image overrides that matched any containers
+	matchedImages map[string]bool
+	// renameWarnings are about references and selectors that could not be renamed
+	renameWarnings []string
+	// undeclaredParameters are reported as warnings when these are allowed
+	undeclaredParameters      []string
+	allowUndeclaredParameters bool
+	// provenanceAnnotations, omitVersion and styles of the output are set from the bundle
+	provenanceAnnotations bool
+	omitVersion           bool
+	yamlStyle             string
+	jsonStyle             string
 }
 
 type AnyResource struct {
@@ -51,20 +110,50 @@ type AnyResource struct {
 }
 
 type ModuleParameter struct {
-	Name     string      `yaml:"name" json:"name" hcl:",key"`
-	Type     string      `yaml:"type" json:"type" hcl:"type"`
-	Required bool        `yaml:"required" json:"required" hcl:"required"`
-	Default  interface{} `yaml:"default" json:"default" hcl:"default"`
+	Name      string      `yaml:"name" json:"name" hcl:",key"`
+	Type      string      `yaml:"type" json:"type" hcl:"type"`
+	Required  bool        `yaml:"required" json:"required" hcl:"required"`
+	Default   interface{} `yaml:"default" json:"default" hcl:"default"`
+	Sensitive bool        `yaml:"sensitive,omitempty" json:"sensitive,omitempty" hcl:"sensitive"`
+
+	Description string      `yaml:"description,omitempty" json:"description,omitempty" hcl:"description"`
+	Example     interface{} `yaml:"example,omitempty" json:"example,omitempty" hcl:"example"`
+
+	// constraints that are checked once the value is set
+	Enum      []interface{} `yaml:"enum,omitempty" json:"enum,omitempty" hcl:"enum"`
+	Pattern   string        `yaml:"pattern,omitempty" json:"pattern,omitempty" hcl:"pattern"`
+	Min       *float64      `yaml:"min,omitempty" json:"min,omitempty" hcl:"min"`
+	Max       *float64      `yaml:"max,omitempty" json:"max,omitempty" hcl:"max"`
+	MinLength *int          `yaml:"minLength,omitempty" json:"minLength,omitempty" hcl:"min_length"`
+	MaxLength *int          `yaml:"maxLength,omitempty" json:"maxLength,omitempty" hcl:"max_length"`
+
+	declaredIn ManifestPath
 }
 
 type ModuleInternal struct {
 	Name  string      `yaml:"name" json:"name" hcl:",key"`
 	Type  string      `yaml:"type" json:"type" hcl:"type"`
 	Value interface{} `yaml:"value" json:"value" hcl:"value"`
+
+	Description string      `yaml:"description,omitempty" json:"description,omitempty" hcl:"description"`
+	Example     interface{} `yaml:"example,omitempty" json:"example,omitempty" hcl:"example"`
+
+	declaredIn ManifestPath
 }
 
-type attribute struct {
-	Type  string      `yaml:"type" json:"type" hcl:"type"`
+type ModuleOutput struct {
+	Name  string      `yaml:"name" json:"name" hcl:",key"`
 	Value interface{} `yaml:"value" json:"value" hcl:"value"`
-	Kind  string      `yaml:"kind" json:"kind" hcl:"kind"`
+
+	Description string `yaml:"description,omitempty" json:"description,omitempty" hcl:"description"`
+
+	declaredIn ManifestPath
+}
+
+type attribute struct {
+	Type      string      `yaml:"type" json:"type" hcl:"type"`
+	Value     interface{} `yaml:"value" json:"value" hcl:"value"`
+	Kind      string      `yaml:"kind" json:"kind" hcl:"kind"`
+	Sensitive bool        `yaml:"sensitive" json:"sensitive" hcl:"sensitive"`
+	Source    string      `yaml:"source" json:"source" hcl:"source"`
 }
@@ -0,0 +1,144 @@
+package modules
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AllowUndeclaredParameters makes parameters that are set for a module instance, but not declared
+// by the module, a warning instead of an error, which is useful while migrating the modules
+func (b *Bundle) AllowUndeclaredParameters() { b.allowUndeclaredParameters = true }
+
+// checkUndeclaredParameters returns an error if the instance sets a parameter that the module doesn't
+// declare, parameters set at the top-level of the bundle are shared by all modules, so these are checked
+// once all of the modules are loaded
+func (m *Module) checkUndeclaredParameters(instance ModuleInstance) error {
+	declared := []string{}
+	for name, attribute := range m.attributes {
+		if attribute.Kind == "parameter" {
+			declared = append(declared, name)
+		}
+	}
+	sort.Strings(declared)
+
+	names := []string{}
+	for name := range instance.Parameters {
+		if _, ok := m.attributes[name]; ok && m.attributes[name].Kind == "parameter" {
+			continue
+		}
+		if instance.parameterSources[name] == "bundle" {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	m.undeclaredParameters = nil
+	for _, name := range names {
+		problem := fmt.Sprintf("module %q does not declare parameter %q", instance.Name, name)
+		if suggestion := suggestName(name, declared); suggestion != "" {
+			problem += fmt.Sprintf(" (did you mean %q?)", suggestion)
+		}
+		m.undeclaredParameters = append(m.undeclaredParameters, problem)
+	}
+
+	if len(m.undeclaredParameters) > 0 && !m.allowUndeclaredParameters {
+		return fmt.Errorf("%s", strings.Join(m.undeclaredParameters, ", "))
+	}
+	return nil
+}
+
+// checkUndeclaredParameters returns an error if a parameter set at the top-level of the bundle
+// is not declared by any of the modules that were loaded, which is most likely a typo
+func (b *Bundle) checkUndeclaredParameters() error {
+	b.undeclaredParameters = nil
+	// the modules that weren't selected may declare any of the parameters
+	if len(b.Parameters) == 0 || b.selectedModulesOnly {
+		return nil
+	}
+
+	declared := map[string]bool{}
+	for _, m := range b.loadedModules {
+		for name, attribute := range m.attributes {
+			if attribute.Kind == "parameter" {
+				declared[name] = true
+			}
+		}
+	}
+	declaredNames := []string{}
+	for name := range declared {
+		declaredNames = append(declaredNames, name)
+	}
+	sort.Strings(declaredNames)
+
+	names := []string{}
+	for name := range b.Parameters {
+		if !declared[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		problem := fmt.Sprintf("bundle parameter %q is not declared by any of the modules", name)
+		if suggestion := suggestName(name, declaredNames); suggestion != "" {
+			problem += fmt.Sprintf(" (did you mean %q?)", suggestion)
+		}
+		b.undeclaredParameters = append(b.undeclaredParameters, problem)
+	}
+
+	if len(b.undeclaredParameters) > 0 && !b.allowUndeclaredParameters {
+		return fmt.Errorf("%s", strings.Join(b.undeclaredParameters, ", "))
+	}
+	return nil
+}
+
+// suggestName returns the closest of the given names, unless none of them are close enough
+func suggestName(name string, names []string) string {
+	suggestion, best := "", len(name)/3+1
+	if best < 2 {
+		best = 2
+	}
+	for _, candidate := range names {
+		if d := editDistance(name, candidate); d <= best {
+			suggestion, best = candidate, d
+			if d == 0 {
+				break
+			}
+		}
+	}
+	return suggestion
+}
+
+// editDistance is the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min3(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,128 @@
+package modules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUndeclaredParameters(t *testing.T) {
+	tests := []struct {
+		bundle  string
+		allow   bool
+		err     string
+		warning string
+	}{
+		{
+			bundle: `
+Modules:
+- Name: app
+  SourceDir: modules/app
+  Parameters: { domain: example.com, imgae: "app:2" }
+`,
+			err: `module "app" does not declare parameter "imgae" (did you mean "image"?)`,
+		},
+		{
+			bundle: `
+Modules:
+- Name: app
+  SourceDir: modules/app
+  Parameters: { domain: example.com, replicas: 3, imgae: "app:2" }
+`,
+			err: `module "app" does not declare parameter "imgae" (did you mean "image"?), ` +
+				`module "app" does not declare parameter "replicas"`,
+		},
+		{
+			bundle: `
+Modules:
+- Name: app
+  SourceDir: modules/app
+  Parameters: { domain: example.com, tokne: s3cr3t }
+`,
+			allow:   true,
+			warning: `module "app" does not declare parameter "tokne" (did you mean "token"?)`,
+		},
+		{
+			// parameters of the bundle are shared by all modules, so each of these has to be declared by any of them
+			bundle: `
+Parameters: { domain: example.com, db_name: users }
+Modules:
+- Name: app
+  SourceDir: modules/app
+- Name: db
+  SourceDir: modules/db
+`,
+		},
+		{
+			bundle: `
+Parameters: { domain: example.com, imgae: "app:2", replicas: 3 }
+Modules:
+- Name: app
+  SourceDir: modules/app
+- Name: db
+  SourceDir: modules/db
+`,
+			err: `bundle parameter "imgae" is not declared by any of the modules (did you mean "image"?), ` +
+				`bundle parameter "replicas" is not declared by any of the modules`,
+		},
+		{
+			bundle: `
+Parameters: { domain: example.com, replicas: 3 }
+Modules:
+- Name: app
+  SourceDir: modules/app
+`,
+			allow:   true,
+			warning: `bundle parameter "replicas" is not declared by any of the modules`,
+		},
+	}
+
+	for _, test := range tests {
+		dir := writeFiles(t, map[string]string{
+			"modules/app/app.yml": appModule,
+			"modules/db/db.yml":   "Kind: kubegen.k8s.io/Module.v1alpha2\nParameters:\n- name: db_name\n  type: String\n  default: db\n",
+			"bundle.yml":          "Kind: kubegen.k8s.io/Bundle.v1alpha2\n" + test.bundle,
+		})
+		defer os.RemoveAll(dir)
+
+		bundle, err := NewBundle(filepath.Join(dir, "bundle.yml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.allow {
+			bundle.AllowUndeclaredParameters()
+		}
+		err = bundle.LoadModules(nil)
+		if test.err != "" {
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), test.err)
+			}
+			continue
+		}
+		if !assert.NoError(t, err) {
+			continue
+		}
+		if test.warning == "" {
+			assert.Empty(t, bundle.Warnings())
+		} else {
+			assert.Equal(t, []string{test.warning}, bundle.Warnings())
+		}
+	}
+}
+
+func TestSuggestName(t *testing.T) {
+	names := []string{"domain", "image", "image_registry", "token"}
+	tests := map[string]string{
+		"imgae":          "image",
+		"images":         "image",
+		"image_regsitry": "image_registry",
+		"Domain":         "domain",
+		"replicas":       "",
+		"t":              "",
+	}
+	for name, suggestion := range tests {
+		assert.Equal(t, suggestion, suggestName(name, names), name)
+	}
+}
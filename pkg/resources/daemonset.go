@@ -22,7 +22,7 @@ func (i DaemonSet) ToObject(localGroup *Group) (runtime.Object, error) {
 func (i *DaemonSet) Convert(localGroup *Group) (*appsv1.DaemonSet, error) {
 	meta := i.Metadata.Convert(i.Name, localGroup)
 
-	pod, err := MakePod(meta, i.Pod)
+	pod, err := MakePod(meta, i.Pod, localGroup)
 	if err != nil {
 		return nil, fmt.Errorf("unable to define pod for DaemonSet  %q – %v", i.Name, err)
 	}
@@ -33,11 +33,7 @@ func (i *DaemonSet) Convert(localGroup *Group) (*appsv1.DaemonSet, error) {
 
 	deepcopier.Copy(i).To(&daemonSetSpec)
 
-	if len(i.Selector) == 0 {
-		daemonSetSpec.Selector = &metav1.LabelSelector{MatchLabels: meta.Labels}
-	} else {
-		daemonSetSpec.Selector = &metav1.LabelSelector{MatchLabels: i.Selector}
-	}
+	daemonSetSpec.Selector = &metav1.LabelSelector{MatchLabels: i.Metadata.Selector(i.Name, i.Selector, localGroup)}
 
 	daemonSet := appsv1.DaemonSet{
 		TypeMeta: metav1.TypeMeta{
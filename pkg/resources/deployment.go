@@ -23,7 +23,7 @@ func (i Deployment) ToObject(localGroup *Group) (runtime.Object, error) {
 func (i *Deployment) Convert(localGroup *Group) (*appsv1.Deployment, error) {
 	meta := i.Metadata.Convert(i.Name, localGroup)
 
-	pod, err := MakePod(meta, i.Pod)
+	pod, err := MakePod(meta, i.Pod, localGroup)
 	if err != nil {
 		return nil, fmt.Errorf("unable to define pod for Deployment %q – %v", i.Name, err)
 	}
@@ -35,11 +35,7 @@ func (i *Deployment) Convert(localGroup *Group) (*appsv1.Deployment, error) {
 
 	deepcopier.Copy(i).To(&deploymentSpec)
 
-	if len(i.Selector) == 0 {
-		deploymentSpec.Selector = &metav1.LabelSelector{MatchLabels: meta.Labels}
-	} else {
-		deploymentSpec.Selector = &metav1.LabelSelector{MatchLabels: i.Selector}
-	}
+	deploymentSpec.Selector = &metav1.LabelSelector{MatchLabels: i.Metadata.Selector(i.Name, i.Selector, localGroup)}
 
 	deploymentSpec.Strategy = i.Strategy.Convert()
 
@@ -12,6 +12,8 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"github.com/ulule/deepcopier"
+
+	"github.com/errordeveloper/kubegen/pkg/util"
 )
 
 func (i *Container) maybeAddEnvVars(container *corev1.Container) {
@@ -248,12 +250,16 @@ func (i *Volume) Convert() (*corev1.Volume, error) {
 	return &volume, nil
 }
 
-func MakePod(parentMeta metav1.ObjectMeta, spec Pod) (*corev1.PodTemplateSpec, error) {
+func MakePod(parentMeta metav1.ObjectMeta, spec Pod, localGroup *Group) (*corev1.PodTemplateSpec, error) {
 	meta := metav1.ObjectMeta{
 		Labels:      parentMeta.Labels,
 		Annotations: spec.Annotations,
 	}
 
+	if localGroup != nil {
+		meta.Annotations = util.MergeStringMaps(localGroup.CommonAnnotations, meta.Annotations)
+	}
+
 	podSpec := corev1.PodSpec{
 		Containers: []corev1.Container{},
 		Volumes:    []corev1.Volume{},
@@ -22,7 +22,7 @@ func (i ReplicaSet) ToObject(localGroup *Group) (runtime.Object, error) {
 func (i *ReplicaSet) Convert(localGroup *Group) (*appsv1.ReplicaSet, error) {
 	meta := i.Metadata.Convert(i.Name, localGroup)
 
-	pod, err := MakePod(meta, i.Pod)
+	pod, err := MakePod(meta, i.Pod, localGroup)
 	if err != nil {
 		return nil, fmt.Errorf("unable to define pod for ReplicaSet %q – %v", i.Name, err)
 	}
@@ -34,11 +34,7 @@ func (i *ReplicaSet) Convert(localGroup *Group) (*appsv1.ReplicaSet, error) {
 
 	deepcopier.Copy(i).To(&replicaSetSpec)
 
-	if len(i.Selector) == 0 {
-		replicaSetSpec.Selector = &metav1.LabelSelector{MatchLabels: meta.Labels}
-	} else {
-		replicaSetSpec.Selector = &metav1.LabelSelector{MatchLabels: i.Selector}
-	}
+	replicaSetSpec.Selector = &metav1.LabelSelector{MatchLabels: i.Metadata.Selector(i.Name, i.Selector, localGroup)}
 
 	replicaSet := appsv1.ReplicaSet{
 		TypeMeta: metav1.TypeMeta{
@@ -35,10 +35,18 @@ func exclusiveNonNil(args ...interface{}) *int {
 	return &index
 }
 
+// labels returns labels declared for the object, or the default `name` label
+func (i *Metadata) labels(name string) map[string]string {
+	if len(i.Labels) == 0 {
+		return map[string]string{"name": name}
+	}
+	return i.Labels
+}
+
 func (i *Metadata) Convert(name string, localGroup *Group) metav1.ObjectMeta {
 	meta := metav1.ObjectMeta{
 		Name:        name,
-		Labels:      i.Labels,
+		Labels:      i.labels(name),
 		Annotations: i.Annotations,
 		Namespace:   i.Namespace,
 	}
@@ -47,22 +55,107 @@ func (i *Metadata) Convert(name string, localGroup *Group) metav1.ObjectMeta {
 		if meta.Namespace == "" && localGroup.Namespace != "" {
 			meta.Namespace = localGroup.Namespace
 		}
-	}
 
-	if len(meta.Labels) == 0 {
-		meta.Labels = map[string]string{"name": name}
+		// labels and annotations of the object take precedence over common ones
+		meta.Labels = util.MergeStringMaps(localGroup.CommonLabels, meta.Labels)
+		meta.Annotations = util.MergeStringMaps(localGroup.CommonAnnotations, meta.Annotations)
 	}
 
 	return meta
 }
 
+// Selector returns given selector, or labels declared for the object, common labels
+// are only added if the group has CommonLabelsInSelectors set
+func (i *Metadata) Selector(name string, selector map[string]string, localGroup *Group) map[string]string {
+	if len(selector) == 0 {
+		selector = i.labels(name)
+	}
+
+	if localGroup != nil && localGroup.CommonLabelsInSelectors {
+		selector = util.MergeStringMaps(localGroup.CommonLabels, selector)
+	}
+
+	return selector
+}
+
 func (i Anything) ToObject(localGroup *Group) (runtime.Object, error) {
 	jsonData, err := json.Marshal(i.Object)
 	if err != nil {
 		return runtime.Object(nil), err
 	}
+
+	if localGroup != nil && (len(localGroup.CommonLabels) > 0 || len(localGroup.CommonAnnotations) > 0) {
+		// a copy is made, so that the original object remains unchanged
+		obj := make(map[string]interface{})
+		if err := json.Unmarshal(jsonData, &obj); err != nil {
+			return runtime.Object(nil), err
+		}
+		localGroup.addCommonMetadata(obj)
+		if jsonData, err = json.Marshal(obj); err != nil {
+			return runtime.Object(nil), err
+		}
+	}
+
 	return util.Decode(jsonData)
 }
+
+func getNestedObject(obj map[string]interface{}, create bool, keys ...string) map[string]interface{} {
+	for _, k := range keys {
+		nested, ok := obj[k].(map[string]interface{})
+		if !ok {
+			if !create {
+				return nil
+			}
+			nested = make(map[string]interface{})
+			obj[k] = nested
+		}
+		obj = nested
+	}
+	return obj
+}
+
+func mergeNestedStringMap(obj map[string]interface{}, create bool, values map[string]string, keys ...string) {
+	if len(values) == 0 {
+		return
+	}
+	nested := getNestedObject(obj, create, keys...)
+	if nested == nil {
+		return
+	}
+	for k, v := range values {
+		// values set in the object take precedence over common ones
+		if _, ok := nested[k]; !ok {
+			nested[k] = v
+		}
+	}
+}
+
+// addCommonMetadata adds common labels and annotations to a raw resource, as well as
+// to the pod template and selectors, if it's one of the well-known pod controllers
+func (i *Group) addCommonMetadata(obj map[string]interface{}) {
+	mergeNestedStringMap(obj, true, i.CommonLabels, "metadata", "labels")
+	mergeNestedStringMap(obj, true, i.CommonAnnotations, "metadata", "annotations")
+
+	kind, _ := obj["kind"].(string)
+	switch kind {
+	case "Deployment", "ReplicaSet", "DaemonSet", "StatefulSet", "ReplicationController", "Job":
+		if getNestedObject(obj, false, "spec", "template") != nil {
+			mergeNestedStringMap(obj, true, i.CommonLabels, "spec", "template", "metadata", "labels")
+			mergeNestedStringMap(obj, true, i.CommonAnnotations, "spec", "template", "metadata", "annotations")
+		}
+		if i.CommonLabelsInSelectors {
+			if kind == "ReplicationController" {
+				mergeNestedStringMap(obj, false, i.CommonLabels, "spec", "selector")
+			} else {
+				mergeNestedStringMap(obj, false, i.CommonLabels, "spec", "selector", "matchLabels")
+			}
+		}
+	case "Service":
+		if i.CommonLabelsInSelectors {
+			mergeNestedStringMap(obj, false, i.CommonLabels, "spec", "selector")
+		}
+	}
+}
 func (i *Group) EncodeListToYAML() ([]byte, error) {
 	list, err := i.MakeList()
 	if err != nil {
@@ -80,11 +80,7 @@ func (i *Service) Convert(localGroup *Group) (*corev1.Service, error) {
 
 	deepcopier.Copy(i).To(&serviceSpec)
 
-	if len(i.Selector) == 0 {
-		serviceSpec.Selector = meta.Labels
-	} else {
-		serviceSpec.Selector = i.Selector
-	}
+	serviceSpec.Selector = i.Metadata.Selector(i.Name, i.Selector, localGroup)
 
 	nodePortIsSet := false
 
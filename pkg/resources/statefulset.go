@@ -22,7 +22,7 @@ func (i StatefulSet) ToObject(localGroup *Group) (runtime.Object, error) {
 func (i *StatefulSet) Convert(localGroup *Group) (*appsv1.StatefulSet, error) {
 	meta := i.Metadata.Convert(i.Name, localGroup)
 
-	pod, err := MakePod(meta, i.Pod)
+	pod, err := MakePod(meta, i.Pod, localGroup)
 	if err != nil {
 		return nil, fmt.Errorf("unable to define pod for StatefulSet %q – %v", i.Name, err)
 	}
@@ -34,11 +34,7 @@ func (i *StatefulSet) Convert(localGroup *Group) (*appsv1.StatefulSet, error) {
 
 	deepcopier.Copy(i).To(&statefulSetSpec)
 
-	if len(i.Selector) == 0 {
-		statefulSetSpec.Selector = &metav1.LabelSelector{MatchLabels: meta.Labels}
-	} else {
-		statefulSetSpec.Selector = &metav1.LabelSelector{MatchLabels: i.Selector}
-	}
+	statefulSetSpec.Selector = &metav1.LabelSelector{MatchLabels: i.Metadata.Selector(i.Name, i.Selector, localGroup)}
 
 	for _, volumeClaim := range i.VolumeClaimTemplates {
 		statefulSetSpec.VolumeClaimTemplates = append(statefulSetSpec.VolumeClaimTemplates, volumeClaim)
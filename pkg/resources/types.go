@@ -24,6 +24,14 @@ type Group struct {
 	ConfigMaps   []ConfigMap   `yaml:"ConfigMaps" hcl:"configmap"`
 	Secrets      []Secret      `yaml:"Secrets" hcl:"secret"`
 	Anything     []Anything    `yaml:"Resources" hcl:"resources"`
+
+	// CommonLabels and CommonAnnotations are added to all objects in the group, these are set
+	// by the module instance, and cannot be set in a manifest
+	CommonLabels      map[string]string `json:"-" yaml:"-" hcl:"-"`
+	CommonAnnotations map[string]string `json:"-" yaml:"-" hcl:"-"`
+	// CommonLabelsInSelectors adds common labels to selectors as well, it is not set by
+	// default, as selectors of existing objects are immutable
+	CommonLabelsInSelectors bool `json:"-" yaml:"-" hcl:"-"`
 }
 
 type Metadata struct {
@@ -106,7 +114,7 @@ type Secret struct {
 }
 
 type Pod struct {
-	Annotations                   map[string]string    `yaml:"podAnnotations,omitempty" hcl:"pod_annotations" deepcopier:"skip"`
+	Annotations                   map[string]string    `yaml:"podAnnotations,omitempty" json:"podAnnotations,omitempty" hcl:"pod_annotations" deepcopier:"skip"`
 	Volumes                       []Volume             `yaml:"volumes,omitempty" hcl:"volume" deepcopier:"skip"`
 	InitContainers                []Container          `yaml:"initContainers,omitempty" hcl:"init_container" deepcopier:"skip"`
 	Containers                    []Container          `yaml:"containers,omitempty" hcl:"container" deepcopier:"skip"`
@@ -0,0 +1,135 @@
+package util
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// Redacted is what sensitive values get replaced with
+const Redacted = "<redacted>"
+
+// RedactString replaces any of the values found in s, unless a value is a part of a longer word,
+// so that a short value (e.g. a single letter) doesn't mangle the rest of the text
+func RedactString(s string, values []string) string {
+	// longest values go first, in case one contains the other
+	sorted := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != "" {
+			sorted = append(sorted, v)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	for _, v := range sorted {
+		s = redactWord(s, v)
+	}
+	return s
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || ('0' <= b && b <= '9') || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z')
+}
+
+// redactWord replaces all occurrences of v in s, which are not adjacent to any other word characters
+func redactWord(s, v string) string {
+	output := []byte{}
+	last := 0
+	for start := 0; start < len(s); {
+		i := strings.Index(s[start:], v)
+		if i < 0 {
+			break
+		}
+		i += start
+		end := i + len(v)
+		if (i > 0 && isWordByte(s[i-1]) && isWordByte(v[0])) ||
+			(end < len(s) && isWordByte(s[end]) && isWordByte(v[len(v)-1])) {
+			start = i + 1
+			continue
+		}
+		output = append(append(output, s[last:i]...), Redacted...)
+		last, start = end, end
+	}
+	return string(append(output, s[last:]...))
+}
+
+// maskStringsInValue redacts the values wherever these appear in strings, e.g. in a joined argument
+// or in a config file that is embedded in a ConfigMap
+func maskStringsInValue(obj interface{}, values []string) interface{} {
+	switch v := obj.(type) {
+	case string:
+		return RedactString(v, values)
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = maskStringsInValue(v[k], values)
+		}
+		return v
+	case []interface{}:
+		for k := range v {
+			v[k] = maskStringsInValue(v[k], values)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func maskObject(obj map[string]interface{}, values []string) {
+	if kind, _ := obj["kind"].(string); kind == "Secret" {
+		return
+	}
+	maskStringsInValue(obj, values)
+}
+
+// MaskValues redacts any of the values in strings of objects other than Secrets
+func MaskValues(contentType string, input []byte, pretty bool, values []string) ([]byte, error) {
+	obj := make(map[string]interface{})
+	var (
+		output []byte
+		err    error
+	)
+
+	doMask := func() {
+		if kind, _ := obj["kind"].(string); kind != "List" {
+			maskObject(obj, values)
+			return
+		}
+		rangeOverNonEmptyMapsInSlice(obj, "items", func(item map[string]interface{}) {
+			maskObject(item, values)
+		})
+	}
+
+	switch contentType {
+	case "application/yaml":
+		if err = yaml.Unmarshal(input, &obj); err != nil {
+			return nil, err
+		}
+
+		doMask()
+
+		if output, err = yaml.Marshal(obj); err != nil {
+			return nil, err
+		}
+		return output, nil
+	case "application/json":
+		if err = json.Unmarshal(input, &obj); err != nil {
+			return nil, err
+		}
+
+		doMask()
+
+		if pretty {
+			output, err = json.MarshalIndent(obj, "", "  ")
+		} else {
+			output, err = json.Marshal(obj)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return output, nil
+	default:
+		return input, nil
+	}
+}
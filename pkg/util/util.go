@@ -4,15 +4,14 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"path"
+	"strings"
 
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/kubernetes/pkg/printers"
 
-	appsv1 "k8s.io/api/apps/v1"
-	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/ghodss/yaml"
@@ -53,53 +52,19 @@ func Decode(data []byte) (runtime.Object, error) {
 	return obj, nil
 }
 
-func DumpListToFiles(list *metav1.List, contentType string) ([]string, error) {
-	filenames := []string{}
-	for _, item := range list.Items {
-		var (
-			name, filename, filenamefmt string
-		)
-
-		i := item.Object
-
-		switch i.GetObjectKind().GroupVersionKind().Kind {
-		case "Service":
-			filenamefmt = "%s-svc.%s"
-			name = i.(*corev1.Service).ObjectMeta.Name
-		case "Deployment":
-			filenamefmt = "%s-dpl.%s"
-			name = i.(*appsv1.Deployment).ObjectMeta.Name
-		case "ReplicaSet":
-			filenamefmt = "%s-rs.%s"
-			name = i.(*appsv1.ReplicaSet).ObjectMeta.Name
-		case "DaemonSet":
-			filenamefmt = "%s-ds.%s"
-			name = i.(*appsv1.DaemonSet).ObjectMeta.Name
-		case "StatefulSet":
-			filenamefmt = "%s-ss.%s"
-			name = i.(*appsv1.StatefulSet).ObjectMeta.Name
-		}
-
-		data, err := Encode(i, contentType, true)
-		if err != nil {
-			return nil, err
-		}
-
-		switch contentType {
-		case "application/yaml":
-			filename = fmt.Sprintf(filenamefmt, name, "yaml")
-			data = append([]byte(fmt.Sprintf("# generated by kubegen\n# => %s\n---\n", filename)), data...)
-		case "application/json":
-			filename = fmt.Sprintf(filenamefmt, name, "yaml")
-		}
-
-		if err := ioutil.WriteFile(filename, data, 0644); err != nil {
-			return nil, fmt.Errorf("kubegen/util: error writing to file %q – %v", filename, err)
-		}
-		filenames = append(filenames, filename)
+// ObjectFilename returns name of the file to write an object of any kind to, i.e. "<kind>-<name>.<ext>",
+// or "<kind>/<name>.<ext>" if each kind gets its own directory, kinds are in lower case
+func ObjectFilename(obj runtime.Object, ext string, perKindDirectory bool) (string, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return "", fmt.Errorf("kubegen/util: error reading object metadata – %v", err)
 	}
 
-	return filenames, nil
+	kind := strings.ToLower(obj.GetObjectKind().GroupVersionKind().Kind)
+	if perKindDirectory {
+		return path.Join(kind, accessor.GetName()+"."+ext), nil
+	}
+	return fmt.Sprintf("%s-%s.%s", kind, accessor.GetName(), ext), nil
 }
 
 func NewFromHCL(obj interface{}, data []byte) error {
@@ -152,3 +117,19 @@ func EnsureJSON(data []byte) ([]byte, error) {
 	}
 	return json.Marshal(obj)
 }
+
+// MergeStringMaps returns a new map with values from base and override, where values
+// in override take precedence, it returns nil if both maps are empty
+func MergeStringMaps(base, override map[string]string) map[string]string {
+	if len(base) == 0 && len(override) == 0 {
+		return nil
+	}
+	result := make(map[string]string, len(base)+len(override))
+	for k, v := range base {
+		result[k] = v
+	}
+	for k, v := range override {
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,7 @@
+// Package version holds the version of kubegen, which is set at build time with
+//
+//	go build -ldflags "-X github.com/errordeveloper/kubegen/pkg/version.Version=<version>" ./cmd/kubegen
+package version
+
+// Version is "dev" unless it's set at build time
+var Version = "dev"